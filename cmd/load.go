@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	pkgcmd "github.com/wandera/git2kube/pkg/cmd"
 	"github.com/wandera/git2kube/pkg/fetch"
@@ -10,18 +13,46 @@ import (
 )
 
 var lp = struct {
-	kubeconfig  bool
-	git         string
-	branch      string
-	folder      string
-	target      string
-	namespace   string
-	mergetype   string
-	includes    []string
-	excludes    []string
-	sshkey      string
-	labels      []string
-	annotations []string
+	kubeconfig        bool
+	git               string
+	branch            string
+	folder            string
+	target            string
+	namespace         string
+	mergetype         string
+	filterSyntax      string
+	includes          []string
+	excludes          []string
+	ignoreFile        string
+	sshkey            string
+	labels            []string
+	annotations       []string
+	ageKeyFile        string
+	ageDecrypt        []string
+	templates         []string
+	templateValues    string
+	templateEnvAllow  []string
+	validate          []string
+	validateSchemas   []string
+	envsubst          []string
+	envsubstAllow     []string
+	keyStrategy       string
+	keySeparator      string
+	keyRenames        []string
+	splitDepth        int
+	nameTemplate      string
+	targetNamespaces  []string
+	namespaceSelector string
+	pruneNamespaces   bool
+	ownerReference    string
+	atomic            bool
+	revisions         int
+	fileMode          string
+	dirMode           string
+	owner             string
+	keepExisting      bool
+	prune             bool
+	output            string
 }{}
 
 var loadCmd = &cobra.Command{
@@ -33,6 +64,7 @@ var loadCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		globFilterDefaults(cmd, lp.filterSyntax, &lp.includes, &lp.excludes)
 		// Call rootCmd's PersistentPreRunE if set
 		if rootCmd.PersistentPreRunE != nil {
 			return rootCmd.PersistentPreRunE(cmd, args)
@@ -68,7 +100,21 @@ var loadFolderCmd = &cobra.Command{
 	},
 }
 
+var loadManifestsCmd = &cobra.Command{
+	Use:                "manifests",
+	Short:              "Loads files from git repository as K8s manifests and applies them",
+	DisableFlagParsing: true,
+	RunE: func(c *cobra.Command, args []string) error {
+		return executeLoad(upload.Manifests)
+	},
+}
+
 func executeLoad(lt upload.LoadType) error {
+	// Keep stdout clean for the results
+	if lp.output == "-" {
+		log.SetOutput(os.Stderr)
+	}
+
 	// #nosec G301
 	if err := os.MkdirAll(lp.folder, os.ModePerm); err != nil {
 		return err
@@ -92,62 +138,176 @@ func executeLoad(lt upload.LoadType) error {
 	}
 
 	uploader, err := upload.NewUploader(lt, upload.UploaderOptions{
-		Source:      lp.folder,
-		Kubeconfig:  lp.kubeconfig,
-		Target:      lp.target,
-		Namespace:   lp.namespace,
-		MergeType:   upload.MergeType(lp.mergetype),
-		Includes:    lp.includes,
-		Excludes:    lp.excludes,
-		Annotations: lp.annotations,
-		Labels:      lp.labels,
+		Source:            lp.folder,
+		Kubeconfig:        lp.kubeconfig,
+		Repository:        lp.git,
+		Branch:            lp.branch,
+		Target:            lp.target,
+		Namespace:         lp.namespace,
+		MergeType:         upload.MergeType(lp.mergetype),
+		FilterSyntax:      upload.FilterSyntax(lp.filterSyntax),
+		Includes:          lp.includes,
+		Excludes:          lp.excludes,
+		IgnoreFile:        lp.ignoreFile,
+		Annotations:       lp.annotations,
+		Labels:            lp.labels,
+		AgeKeyFile:        lp.ageKeyFile,
+		AgeDecrypt:        lp.ageDecrypt,
+		Templates:         lp.templates,
+		TemplateValues:    lp.templateValues,
+		TemplateEnvAllow:  lp.templateEnvAllow,
+		Validate:          lp.validate,
+		ValidateSchemas:   lp.validateSchemas,
+		Envsubst:          lp.envsubst,
+		EnvsubstAllow:     lp.envsubstAllow,
+		KeyStrategy:       upload.KeyStrategy(lp.keyStrategy),
+		KeySeparator:      lp.keySeparator,
+		KeyRenames:        lp.keyRenames,
+		SplitDepth:        lp.splitDepth,
+		NameTemplate:      lp.nameTemplate,
+		Namespaces:        lp.targetNamespaces,
+		NamespaceSelector: lp.namespaceSelector,
+		PruneNamespaces:   lp.pruneNamespaces,
+		OwnerReference:    lp.ownerReference,
+		Atomic:            lp.atomic,
+		Revisions:         lp.revisions,
+		FileMode:          lp.fileMode,
+		DirMode:           lp.dirMode,
+		Owner:             lp.owner,
+		KeepExisting:      lp.keepExisting,
+		Prune:             lp.prune,
 	})
 	if err != nil {
 		return err
 	}
 
-	err = uploader.Upload(c.ID().String(), iter)
+	err = uploader.Upload(c, iter)
+	if err != nil {
+		return err
+	}
+
+	if lp.output != "" {
+		return writeResults(uploader, lp.output)
+	}
+	return nil
+}
+
+// writeResults writes objects written by uploader with their checksums as JSON into output, '-' writes to stdout.
+func writeResults(uploader upload.Uploader, output string) error {
+	reporter, ok := uploader.(upload.Reporter)
+	if !ok {
+		return errors.New("output is not supported by the uploader")
+	}
+
+	results := reporter.Results()
+	if results == nil {
+		results = []upload.Result{}
+	}
+	data, err := json.MarshalIndent(results, "", "  ")
 	if err != nil {
 		return err
 	}
+	data = append(data, '\n')
 
-	return err
+	if output == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	// #nosec G306
+	return os.WriteFile(output, data, 0o644)
 }
 
 func init() {
 	loadCmd.PersistentFlags().StringVarP(&lp.git, "git", "g", "", "git repository address, either http(s) or ssh protocol has to be specified")
 	loadCmd.PersistentFlags().StringVarP(&lp.branch, "branch", "b", "master", "branch name to pull")
 	loadCmd.PersistentFlags().StringVarP(&lp.folder, "cache-folder", "c", "/tmp/git2kube/data/", "destination on filesystem where cache of repository will be stored")
-	loadCmd.PersistentFlags().StringSliceVar(&lp.includes, "include", []string{".*"}, "regex that if is a match includes the file in the upload, example: '*.yaml' or 'folder/*' if you want to match a folder")
-	loadCmd.PersistentFlags().StringSliceVar(&lp.excludes, "exclude", []string{"^\\..*"}, "regex that if is a match excludes the file from the upload, example: '*.yaml' or 'folder/*' if you want to match a folder")
+	loadCmd.PersistentFlags().StringSliceVar(&lp.includes, "include", []string{".*"}, "rule that if is a match includes the file in the upload, regex or glob based on --filter-syntax, example: '\\.yaml$' or '^folder/' as regex, '*.yaml' or 'folder/' as glob (glob default: '**')")
+	loadCmd.PersistentFlags().StringSliceVar(&lp.excludes, "exclude", []string{"^\\..*"}, "rule that if is a match excludes the file from the upload, regex or glob based on --filter-syntax, example: '\\.yaml$' or '^folder/' as regex, '*.yaml' or 'folder/' as glob (glob default: '/.*')")
+	loadCmd.PersistentFlags().StringVar(&lp.filterSyntax, "filter-syntax", string(upload.RegexFilterSyntax), "syntax of --include and --exclude rules, glob rules are gitignore-style with '**' matching any number of directories (options: regex|glob)")
+	loadCmd.PersistentFlags().StringVar(&lp.ignoreFile, "ignore-file", upload.DefaultIgnoreFile, "path of the file in the repository with gitignore-style rules of files excluded from the upload, empty disables it")
+	loadCmd.PersistentFlags().StringSliceVar(&lp.envsubst, "envsubst", []string{}, "regex that if is a match replaces ${VAR} references in the file with values of environment variables allowed by --envsubst-allow, example: '.*\\.conf$'")
+	loadCmd.PersistentFlags().StringSliceVar(&lp.envsubstAllow, "envsubst-allow", []string{}, "name of environment variable that can be substituted in files matched by --envsubst")
+	loadCmd.PersistentFlags().StringSliceVar(&lp.templates, "template", []string{}, "regex that if is a match renders the file as Go template with .Values, .Env (variables allowed by --template-env-allow) and .Commit (Hash, Author, Email, Date, Message) data, example: '.*\\.tmpl$'")
+	loadCmd.PersistentFlags().StringVar(&lp.templateValues, "template-values", "", "path to YAML or JSON file with values available to templates as .Values")
+	loadCmd.PersistentFlags().StringSliceVar(&lp.templateEnvAllow, "template-env-allow", []string{}, "name of environment variable that is available to templates as .Env, other variables can't be read by templates")
+	loadCmd.PersistentFlags().StringSliceVar(&lp.validate, "validate", []string{}, "regex that if is a match validates syntax of the YAML, JSON or TOML file before the upload, invalid file aborts the sync keeping the previous version in target, example: '.*'")
+	loadCmd.PersistentFlags().StringSliceVar(&lp.validateSchemas, "validate-schema", []string{}, "rule validating files matching the regex against JSON Schema stored in the repository (format REGEX=PATH), example: '^apps/.*\\.yaml$=schemas/app.json'")
 	loadCmd.PersistentFlags().StringVarP(&lp.sshkey, "ssh-key", "p", "", "path to the SSH private key (git repository address should be 'git@<address>', example: git@github.com:wandera/git2kube.git)")
 
-	loadCmd.MarkPersistentFlagRequired("git")          // #nosec G104
-	loadCmd.MarkPersistentFlagFilename("cache-folder") // #nosec G104
+	loadCmd.MarkPersistentFlagRequired("git")             // #nosec G104
+	loadCmd.MarkPersistentFlagFilename("cache-folder")    // #nosec G104
+	loadCmd.MarkPersistentFlagFilename("template-values") // #nosec G104
 
 	loadConfigmapCmd.Flags().BoolVarP(&lp.kubeconfig, "kubeconfig", "k", false, "true if locally stored ~/.kube/config should be used, InCluster config will be used if false (options: true|false) (default: false)")
 	loadConfigmapCmd.Flags().StringVarP(&lp.namespace, "namespace", "n", "default", "target namespace for the resulting ConfigMap")
 	loadConfigmapCmd.Flags().StringVarP(&lp.target, "configmap", "m", "", "name for the resulting ConfigMap")
 	loadConfigmapCmd.Flags().StringSliceVar(&lp.labels, "label", []string{}, "label to add to K8s ConfigMap (format NAME=VALUE)")
 	loadConfigmapCmd.Flags().StringSliceVar(&lp.annotations, "annotation", []string{}, "annotation to add to K8s ConfigMap (format NAME=VALUE)")
-	loadConfigmapCmd.Flags().StringVarP(&lp.mergetype, "merge-type", "", "delete", "how to merge ConfigMap data whether to also delete missing values or just upsert new (options: delete|upsert)")
+	loadConfigmapCmd.Flags().StringVarP(&lp.mergetype, "merge-type", "", "delete", "how to merge ConfigMap data whether to also delete missing values, just upsert new or delete only missing values previously written by git2kube (options: delete|upsert|owned)")
+	loadConfigmapCmd.Flags().StringVar(&lp.keyStrategy, "key-strategy", "path", "how to derive ConfigMap keys from file paths (options: path|basename)")
+	loadConfigmapCmd.Flags().StringVar(&lp.keySeparator, "key-separator", ".", "separator replacing '/' in ConfigMap keys when using path key strategy")
+	loadConfigmapCmd.Flags().StringSliceVar(&lp.keyRenames, "key-rename", []string{}, "regex rename rule applied to file path before deriving ConfigMap key (format REGEX=REPLACEMENT, use \\1 to reference capture groups), example: '^config/(.*)=\\1'")
+	loadConfigmapCmd.Flags().IntVar(&lp.splitDepth, "split-depth", 0, "create one ConfigMap per directory at this depth named by --name-template, ConfigMaps of removed directories are deleted and keys are derived from paths relative to the directory (0 disables splitting)")
+	loadConfigmapCmd.Flags().StringVar(&lp.nameTemplate, "name-template", "{{.Name}}-{{.Dir}}", "Go template of ConfigMap names when using --split-depth with .Name (value of --configmap), .Dir (directory name) and .Path (directory path) data")
+	loadConfigmapCmd.Flags().StringSliceVar(&lp.targetNamespaces, "target-namespace", []string{}, "namespace to replicate the ConfigMap into instead of --namespace, can be combined with --namespace-selector")
+	loadConfigmapCmd.Flags().StringVar(&lp.namespaceSelector, "namespace-selector", "", "label selector of namespaces to replicate the ConfigMap into instead of --namespace, namespaces are listed with every sync, example: 'tenant=true'")
+	loadConfigmapCmd.Flags().BoolVar(&lp.pruneNamespaces, "prune-namespaces", false, "delete ConfigMap copies from namespaces that are no longer selected by --target-namespace or --namespace-selector")
+	loadConfigmapCmd.Flags().StringVar(&lp.ownerReference, "owner-reference", "", "owner of created ConfigMaps so that they are deleted with it, either KIND/NAME of Deployment, StatefulSet or DaemonSet in --namespace or 'auto' to use controller of the running pod identified by POD_NAME and POD_NAMESPACE environment variables (Deployment or CronJob of its ReplicaSet or Job), the owner has to be in --namespace")
+	loadConfigmapCmd.Flags().StringVarP(&lp.output, "output", "o", "", "file the written ConfigMaps with their content checksums are stored into as JSON, '-' writes to stdout and moves logs to stderr")
 	loadConfigmapCmd.MarkFlagFilename("kubeconfig") // #nosec G104
 	loadConfigmapCmd.MarkFlagRequired("configmap")  // #nosec G104
+	loadConfigmapCmd.MarkFlagFilename("output")     // #nosec G104
 
 	loadSecretCmd.Flags().BoolVarP(&lp.kubeconfig, "kubeconfig", "k", false, "true if locally stored ~/.kube/config should be used, InCluster config will be used if false (options: true|false) (default: false)")
 	loadSecretCmd.Flags().StringVarP(&lp.namespace, "namespace", "n", "default", "target namespace for the resulting ConfigMap")
 	loadSecretCmd.Flags().StringVarP(&lp.target, "secret", "s", "", "name for the resulting Secret")
 	loadSecretCmd.Flags().StringSliceVar(&lp.labels, "label", []string{}, "label to add to K8s Secret (format NAME=VALUE)")
 	loadSecretCmd.Flags().StringSliceVar(&lp.annotations, "annotation", []string{}, "annotation to add to K8s Secret (format NAME=VALUE)")
-	loadSecretCmd.Flags().StringVarP(&lp.mergetype, "merge-type", "", "delete", "how to merge Secret data whether to also delete missing values or just upsert new (options: delete|upsert)")
-	loadSecretCmd.MarkFlagFilename("kubeconfig") // #nosec G104
-	loadSecretCmd.MarkFlagRequired("secret")     // #nosec G104
+	loadSecretCmd.Flags().StringVarP(&lp.mergetype, "merge-type", "", "delete", "how to merge Secret data whether to also delete missing values, just upsert new or delete only missing values previously written by git2kube (options: delete|upsert|owned)")
+	loadSecretCmd.Flags().StringVar(&lp.ageKeyFile, "age-key-file", "", "path to file with age identities used to decrypt SOPS and age encrypted files, SOPS_AGE_KEY_FILE and SOPS_AGE_KEY environment variables are used as fallback")
+	loadSecretCmd.Flags().StringSliceVar(&lp.ageDecrypt, "age-decrypt", []string{}, "regex that if is a match decrypts the file with age identities and strips the .age suffix from its name, example: '.*\\.age$'")
+	loadSecretCmd.Flags().StringVar(&lp.keyStrategy, "key-strategy", "path", "how to derive Secret keys from file paths (options: path|basename)")
+	loadSecretCmd.Flags().StringVar(&lp.keySeparator, "key-separator", ".", "separator replacing '/' in Secret keys when using path key strategy")
+	loadSecretCmd.Flags().StringSliceVar(&lp.keyRenames, "key-rename", []string{}, "regex rename rule applied to file path before deriving Secret key (format REGEX=REPLACEMENT, use \\1 to reference capture groups), example: '^config/(.*)=\\1'")
+	loadSecretCmd.Flags().IntVar(&lp.splitDepth, "split-depth", 0, "create one Secret per directory at this depth named by --name-template, Secrets of removed directories are deleted and keys are derived from paths relative to the directory (0 disables splitting)")
+	loadSecretCmd.Flags().StringVar(&lp.nameTemplate, "name-template", "{{.Name}}-{{.Dir}}", "Go template of Secret names when using --split-depth with .Name (value of --secret), .Dir (directory name) and .Path (directory path) data")
+	loadSecretCmd.Flags().StringSliceVar(&lp.targetNamespaces, "target-namespace", []string{}, "namespace to replicate the Secret into instead of --namespace, can be combined with --namespace-selector")
+	loadSecretCmd.Flags().StringVar(&lp.namespaceSelector, "namespace-selector", "", "label selector of namespaces to replicate the Secret into instead of --namespace, namespaces are listed with every sync, example: 'tenant=true'")
+	loadSecretCmd.Flags().BoolVar(&lp.pruneNamespaces, "prune-namespaces", false, "delete Secret copies from namespaces that are no longer selected by --target-namespace or --namespace-selector")
+	loadSecretCmd.Flags().StringVar(&lp.ownerReference, "owner-reference", "", "owner of created Secrets so that they are deleted with it, either KIND/NAME of Deployment, StatefulSet or DaemonSet in --namespace or 'auto' to use controller of the running pod identified by POD_NAME and POD_NAMESPACE environment variables (Deployment or CronJob of its ReplicaSet or Job), the owner has to be in --namespace")
+	loadSecretCmd.Flags().StringVarP(&lp.output, "output", "o", "", "file the written Secrets with their content checksums are stored into as JSON, '-' writes to stdout and moves logs to stderr")
+	loadSecretCmd.MarkFlagFilename("kubeconfig")   // #nosec G104
+	loadSecretCmd.MarkFlagRequired("secret")       // #nosec G104
+	loadSecretCmd.MarkFlagFilename("age-key-file") // #nosec G104
+	loadSecretCmd.MarkFlagFilename("output")       // #nosec G104
 
 	loadFolderCmd.Flags().StringVarP(&lp.target, "target-folder", "t", "", "path to target folder")
+	loadFolderCmd.Flags().StringVar(&lp.ageKeyFile, "age-key-file", "", "path to file with age identities used to decrypt age encrypted files, SOPS_AGE_KEY_FILE and SOPS_AGE_KEY environment variables are used as fallback")
+	loadFolderCmd.Flags().StringSliceVar(&lp.ageDecrypt, "age-decrypt", []string{}, "regex that if is a match decrypts the file with age identities and strips the .age suffix from its name, example: '.*\\.age$'")
+	loadFolderCmd.Flags().BoolVar(&lp.atomic, "atomic", false, "write each revision into a new folder and atomically switch the 'current' symlink in target folder to it, consumers should read from '<target-folder>/current'")
+	loadFolderCmd.Flags().IntVar(&lp.revisions, "keep-revisions", 1, "number of previous revisions to keep in target folder when using atomic updates")
+	loadFolderCmd.Flags().StringVar(&lp.fileMode, "file-mode", "0644", "octal permissions of written files, executable files from repository get execute bit wherever read bit is set")
+	loadFolderCmd.Flags().StringVar(&lp.dirMode, "dir-mode", "0755", "octal permissions of created folders")
+	loadFolderCmd.Flags().StringVar(&lp.owner, "owner", "", "owner of written files and folders (format UID:GID), current user if not set")
+	loadFolderCmd.Flags().BoolVar(&lp.keepExisting, "keep-existing", false, "keep existing content of target folder on startup and reconcile it with the first sync instead of removing it")
 	loadFolderCmd.MarkFlagRequired("target-folder") // #nosec G104
 	loadFolderCmd.MarkFlagFilename("target-folder") // #nosec G104
+	loadFolderCmd.MarkFlagFilename("age-key-file")  // #nosec G104
+
+	loadManifestsCmd.Flags().BoolVarP(&lp.kubeconfig, "kubeconfig", "k", false, "true if locally stored ~/.kube/config should be used, InCluster config will be used if false (options: true|false) (default: false)")
+	loadManifestsCmd.Flags().StringVarP(&lp.namespace, "namespace", "n", "default", "namespace of the inventory ConfigMap and of namespaced objects that do not specify one")
+	loadManifestsCmd.Flags().StringVar(&lp.target, "inventory", "", "name of the ConfigMap tracking applied objects, used for pruning")
+	loadManifestsCmd.Flags().StringSliceVar(&lp.labels, "label", []string{}, "label to add to applied K8s objects (format NAME=VALUE)")
+	loadManifestsCmd.Flags().StringSliceVar(&lp.annotations, "annotation", []string{}, "annotation to add to applied K8s objects (format NAME=VALUE)")
+	loadManifestsCmd.Flags().StringVar(&lp.ageKeyFile, "age-key-file", "", "path to file with age identities used to decrypt SOPS and age encrypted files, SOPS_AGE_KEY_FILE and SOPS_AGE_KEY environment variables are used as fallback")
+	loadManifestsCmd.Flags().StringSliceVar(&lp.ageDecrypt, "age-decrypt", []string{}, "regex that if is a match decrypts the file with age identities and strips the .age suffix from its name, example: '.*\\.age$'")
+	loadManifestsCmd.Flags().BoolVar(&lp.prune, "prune", true, "delete previously applied objects that are no longer present in the repository")
+	loadManifestsCmd.MarkFlagFilename("kubeconfig")   // #nosec G104
+	loadManifestsCmd.MarkFlagRequired("inventory")    // #nosec G104
+	loadManifestsCmd.MarkFlagFilename("age-key-file") // #nosec G104
 
 	loadCmd.AddCommand(loadConfigmapCmd)
 	loadCmd.AddCommand(loadSecretCmd)
 	loadCmd.AddCommand(loadFolderCmd)
+	loadCmd.AddCommand(loadManifestsCmd)
 }
@@ -5,6 +5,7 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/wandera/git2kube/pkg/upload"
 )
 
 var (
@@ -44,10 +45,25 @@ func init() {
 
 	rootCmd.AddCommand(loadCmd)
 	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(validateCmd)
 	rootCmd.AddCommand(genDocCmd)
 	rootCmd.AddCommand(versionCmd)
 }
 
+// globFilterDefaults replaces default include and exclude regexes with their glob equivalents
+// if glob filter syntax is used and the rules were not set.
+func globFilterDefaults(cmd *cobra.Command, syntax string, includes *[]string, excludes *[]string) {
+	if upload.FilterSyntax(syntax) != upload.GlobFilterSyntax {
+		return
+	}
+	if !cmd.Flags().Changed("include") {
+		*includes = []string{"**"}
+	}
+	if !cmd.Flags().Changed("exclude") {
+		*excludes = []string{"/.*"}
+	}
+}
+
 // Execute run root command (main entrypoint).
 func Execute() error {
 	return rootCmd.Execute()
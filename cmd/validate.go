@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	pkgcmd "github.com/wandera/git2kube/pkg/cmd"
+	"github.com/wandera/git2kube/pkg/upload"
+)
+
+var vp = struct {
+	folder          string
+	target          string
+	filterSyntax    string
+	includes        []string
+	excludes        []string
+	ignoreFile      string
+	validate        []string
+	validateSchemas []string
+	templates       []string
+	envsubst        []string
+	ageDecrypt      []string
+	keyStrategy     string
+	keySeparator    string
+	keyRenames      []string
+	splitDepth      int
+	nameTemplate    string
+}{}
+
+var validateCmd = &cobra.Command{
+	Use:                "validate",
+	Short:              "Validates files of a local working copy the same way they would be loaded into target",
+	DisableFlagParsing: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		err := pkgcmd.ExpandArgs(cmd, args)
+		if err != nil {
+			return err
+		}
+		globFilterDefaults(cmd, vp.filterSyntax, &vp.includes, &vp.excludes)
+		// Call rootCmd's PersistentPreRunE if set
+		if rootCmd.PersistentPreRunE != nil {
+			return rootCmd.PersistentPreRunE(cmd, args)
+		}
+		return nil
+	},
+}
+
+var validateConfigmapCmd = &cobra.Command{
+	Use:                "configmap",
+	Short:              "Validates files of a local working copy for loading into ConfigMap",
+	DisableFlagParsing: true,
+	SilenceUsage:       true,
+	RunE: func(c *cobra.Command, args []string) error {
+		return executeValidate(upload.ConfigMap)
+	},
+}
+
+var validateSecretCmd = &cobra.Command{
+	Use:                "secret",
+	Short:              "Validates files of a local working copy for loading into Secret",
+	DisableFlagParsing: true,
+	SilenceUsage:       true,
+	RunE: func(c *cobra.Command, args []string) error {
+		return executeValidate(upload.Secret)
+	},
+}
+
+var validateFolderCmd = &cobra.Command{
+	Use:                "folder",
+	Short:              "Validates files of a local working copy for loading into Folder",
+	DisableFlagParsing: true,
+	SilenceUsage:       true,
+	RunE: func(c *cobra.Command, args []string) error {
+		return executeValidate(upload.Folder)
+	},
+}
+
+var validateManifestsCmd = &cobra.Command{
+	Use:                "manifests",
+	Short:              "Validates files of a local working copy for applying as K8s manifests",
+	DisableFlagParsing: true,
+	SilenceUsage:       true,
+	RunE: func(c *cobra.Command, args []string) error {
+		return executeValidate(upload.Manifests)
+	},
+}
+
+func executeValidate(lt upload.LoadType) error {
+	report, err := upload.Check(lt, vp.folder, upload.UploaderOptions{
+		Target:          vp.target,
+		FilterSyntax:    upload.FilterSyntax(vp.filterSyntax),
+		Includes:        vp.includes,
+		Excludes:        vp.excludes,
+		IgnoreFile:      vp.ignoreFile,
+		Validate:        vp.validate,
+		ValidateSchemas: vp.validateSchemas,
+		Templates:       vp.templates,
+		Envsubst:        vp.envsubst,
+		AgeDecrypt:      vp.ageDecrypt,
+		KeyStrategy:     upload.KeyStrategy(vp.keyStrategy),
+		KeySeparator:    vp.keySeparator,
+		KeyRenames:      vp.keyRenames,
+		SplitDepth:      vp.splitDepth,
+		NameTemplate:    vp.nameTemplate,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range report.Problems {
+		if problem.File == "" {
+			fmt.Println(problem.Message)
+		} else {
+			fmt.Printf("%s: %s\n", problem.File, problem.Message)
+		}
+	}
+	fmt.Printf("Checked %d files (%d bytes), found %d problems\n", report.Files, report.Size, len(report.Problems))
+
+	if len(report.Problems) > 0 {
+		return fmt.Errorf("validation of '%s' failed with %d problems", vp.folder, len(report.Problems))
+	}
+	return nil
+}
+
+func init() {
+	validateCmd.PersistentFlags().StringVarP(&vp.folder, "folder", "f", ".", "path to the local working copy of the repository")
+	validateCmd.PersistentFlags().StringSliceVar(&vp.includes, "include", []string{".*"}, "rule that if is a match includes the file in the upload, regex or glob based on --filter-syntax, example: '\\.yaml$' or '^folder/' as regex, '*.yaml' or 'folder/' as glob (glob default: '**')")
+	validateCmd.PersistentFlags().StringSliceVar(&vp.excludes, "exclude", []string{"^\\..*"}, "rule that if is a match excludes the file from the upload, regex or glob based on --filter-syntax, example: '\\.yaml$' or '^folder/' as regex, '*.yaml' or 'folder/' as glob (glob default: '/.*')")
+	validateCmd.PersistentFlags().StringVar(&vp.filterSyntax, "filter-syntax", string(upload.RegexFilterSyntax), "syntax of --include and --exclude rules, glob rules are gitignore-style with '**' matching any number of directories (options: regex|glob)")
+	validateCmd.PersistentFlags().StringVar(&vp.ignoreFile, "ignore-file", upload.DefaultIgnoreFile, "path of the file in the repository with gitignore-style rules of files excluded from the upload, empty disables it")
+	validateCmd.PersistentFlags().StringSliceVar(&vp.validate, "validate", []string{}, "regex that if is a match validates syntax of the YAML, JSON or TOML file, example: '.*'")
+	validateCmd.PersistentFlags().StringSliceVar(&vp.validateSchemas, "validate-schema", []string{}, "rule validating files matching the regex against JSON Schema stored in the repository (format REGEX=PATH), example: '^apps/.*\\.yaml$=schemas/app.json'")
+	validateCmd.PersistentFlags().StringSliceVar(&vp.templates, "template", []string{}, "regex that if is a match marks the file as Go template rendered during the sync, its syntax and schema are not validated, example: '.*\\.tmpl$'")
+	validateCmd.PersistentFlags().StringSliceVar(&vp.envsubst, "envsubst", []string{}, "regex that if is a match marks the file as substituted with environment variables during the sync, its syntax and schema are not validated, example: '.*\\.conf$'")
+	validateCmd.MarkPersistentFlagFilename("folder") // #nosec G104
+
+	validateConfigmapCmd.Flags().StringVarP(&vp.target, "configmap", "m", "", "name for the resulting ConfigMap, required by --split-depth to resolve names of split ConfigMaps")
+	validateConfigmapCmd.Flags().StringVar(&vp.keyStrategy, "key-strategy", "path", "how to derive ConfigMap keys from file paths (options: path|basename)")
+	validateConfigmapCmd.Flags().StringVar(&vp.keySeparator, "key-separator", ".", "separator replacing '/' in ConfigMap keys when using path key strategy")
+	validateConfigmapCmd.Flags().StringSliceVar(&vp.keyRenames, "key-rename", []string{}, "regex rename rule applied to file path before deriving ConfigMap key (format REGEX=REPLACEMENT, use \\1 to reference capture groups), example: '^config/(.*)=\\1'")
+	validateConfigmapCmd.Flags().IntVar(&vp.splitDepth, "split-depth", 0, "check one ConfigMap per directory at this depth named by --name-template, keys are derived from paths relative to the directory (0 disables splitting)")
+	validateConfigmapCmd.Flags().StringVar(&vp.nameTemplate, "name-template", "{{.Name}}-{{.Dir}}", "Go template of ConfigMap names when using --split-depth with .Name (value of --configmap), .Dir (directory name) and .Path (directory path) data")
+
+	validateSecretCmd.Flags().StringVarP(&vp.target, "secret", "s", "", "name for the resulting Secret, required by --split-depth to resolve names of split Secrets")
+	validateSecretCmd.Flags().StringVar(&vp.keyStrategy, "key-strategy", "path", "how to derive Secret keys from file paths (options: path|basename)")
+	validateSecretCmd.Flags().StringVar(&vp.keySeparator, "key-separator", ".", "separator replacing '/' in Secret keys when using path key strategy")
+	validateSecretCmd.Flags().StringSliceVar(&vp.keyRenames, "key-rename", []string{}, "regex rename rule applied to file path before deriving Secret key (format REGEX=REPLACEMENT, use \\1 to reference capture groups), example: '^config/(.*)=\\1'")
+	validateSecretCmd.Flags().IntVar(&vp.splitDepth, "split-depth", 0, "check one Secret per directory at this depth named by --name-template, keys are derived from paths relative to the directory (0 disables splitting)")
+	validateSecretCmd.Flags().StringVar(&vp.nameTemplate, "name-template", "{{.Name}}-{{.Dir}}", "Go template of Secret names when using --split-depth with .Name (value of --secret), .Dir (directory name) and .Path (directory path) data")
+	validateSecretCmd.Flags().StringSliceVar(&vp.ageDecrypt, "age-decrypt", []string{}, "regex that if is a match marks the file as decrypted with age during the sync, the .age suffix is stripped from its name and its content is not validated, example: '.*\\.age$'")
+
+	validateFolderCmd.Flags().StringSliceVar(&vp.ageDecrypt, "age-decrypt", []string{}, "regex that if is a match marks the file as decrypted with age during the sync, the .age suffix is stripped from its name and its content is not validated, example: '.*\\.age$'")
+
+	validateManifestsCmd.Flags().StringSliceVar(&vp.ageDecrypt, "age-decrypt", []string{}, "regex that if is a match marks the file as decrypted with age during the sync, the .age suffix is stripped from its name and its content is not validated, example: '.*\\.age$'")
+
+	validateCmd.AddCommand(validateConfigmapCmd)
+	validateCmd.AddCommand(validateSecretCmd)
+	validateCmd.AddCommand(validateFolderCmd)
+	validateCmd.AddCommand(validateManifestsCmd)
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
 	"path"
@@ -19,23 +21,57 @@ type healthCheckStatus string
 const (
 	ok  healthCheckStatus = "OK"
 	nok healthCheckStatus = "NOK"
+
+	// fetchFailed health check reason of failures to fetch the repository.
+	fetchFailed upload.ErrorReason = "FetchFailed"
 )
 
 var wp = struct {
-	kubeconfig      bool
-	git             string
-	branch          string
-	folder          string
-	target          string
-	namespace       string
-	mergetype       string
-	interval        int
-	includes        []string
-	excludes        []string
-	sshkey          string
-	labels          []string
-	annotations     []string
-	healthCheckFile string
+	kubeconfig        bool
+	git               string
+	branch            string
+	folder            string
+	target            string
+	namespace         string
+	mergetype         string
+	interval          int
+	filterSyntax      string
+	includes          []string
+	excludes          []string
+	ignoreFile        string
+	sshkey            string
+	labels            []string
+	annotations       []string
+	ageKeyFile        string
+	ageDecrypt        []string
+	templates         []string
+	templateValues    string
+	templateEnvAllow  []string
+	validate          []string
+	validateSchemas   []string
+	envsubst          []string
+	envsubstAllow     []string
+	keyStrategy       string
+	keySeparator      string
+	keyRenames        []string
+	splitDepth        int
+	nameTemplate      string
+	targetNamespaces  []string
+	namespaceSelector string
+	pruneNamespaces   bool
+	ownerReference    string
+	events            bool
+	atomic            bool
+	revisions         int
+	fileMode          string
+	dirMode           string
+	owner             string
+	keepExisting      bool
+	prune             bool
+	hookCommand       string
+	hookURL           string
+	hookTimeout       time.Duration
+	healthCheckFile   string
 }{}
 
 var watchCmd = &cobra.Command{
@@ -47,6 +83,7 @@ var watchCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		globFilterDefaults(cmd, wp.filterSyntax, &wp.includes, &wp.excludes)
 		// Call rootCmd's PersistentPreRunE if set
 		if rootCmd.PersistentPreRunE != nil {
 			return rootCmd.PersistentPreRunE(cmd, args)
@@ -82,6 +119,15 @@ var watchFolderCmd = &cobra.Command{
 	},
 }
 
+var watchManifestsCmd = &cobra.Command{
+	Use:                "manifests",
+	Short:              "Runs watcher that periodically check the provided repository and applies K8s manifests from it accordingly",
+	DisableFlagParsing: true,
+	RunE: func(c *cobra.Command, args []string) error {
+		return executeWatch(upload.Manifests)
+	},
+}
+
 func executeWatch(lt upload.LoadType) error {
 	// #nosec G301
 	if err := os.MkdirAll(wp.folder, os.ModePerm); err != nil {
@@ -96,15 +142,48 @@ func executeWatch(lt upload.LoadType) error {
 	fetcher := fetch.NewFetcher(wp.git, wp.folder, wp.branch, auth)
 
 	uploader, err := upload.NewUploader(lt, upload.UploaderOptions{
-		Source:      wp.folder,
-		Kubeconfig:  wp.kubeconfig,
-		Target:      wp.target,
-		Namespace:   wp.namespace,
-		MergeType:   upload.MergeType(wp.mergetype),
-		Includes:    wp.includes,
-		Excludes:    wp.excludes,
-		Annotations: wp.annotations,
-		Labels:      wp.labels,
+		Source:            wp.folder,
+		Kubeconfig:        wp.kubeconfig,
+		Repository:        wp.git,
+		Branch:            wp.branch,
+		Target:            wp.target,
+		Namespace:         wp.namespace,
+		MergeType:         upload.MergeType(wp.mergetype),
+		FilterSyntax:      upload.FilterSyntax(wp.filterSyntax),
+		Includes:          wp.includes,
+		Excludes:          wp.excludes,
+		IgnoreFile:        wp.ignoreFile,
+		Annotations:       wp.annotations,
+		Labels:            wp.labels,
+		AgeKeyFile:        wp.ageKeyFile,
+		AgeDecrypt:        wp.ageDecrypt,
+		Templates:         wp.templates,
+		TemplateValues:    wp.templateValues,
+		TemplateEnvAllow:  wp.templateEnvAllow,
+		Validate:          wp.validate,
+		ValidateSchemas:   wp.validateSchemas,
+		Envsubst:          wp.envsubst,
+		EnvsubstAllow:     wp.envsubstAllow,
+		KeyStrategy:       upload.KeyStrategy(wp.keyStrategy),
+		KeySeparator:      wp.keySeparator,
+		KeyRenames:        wp.keyRenames,
+		SplitDepth:        wp.splitDepth,
+		NameTemplate:      wp.nameTemplate,
+		Namespaces:        wp.targetNamespaces,
+		NamespaceSelector: wp.namespaceSelector,
+		PruneNamespaces:   wp.pruneNamespaces,
+		OwnerReference:    wp.ownerReference,
+		Events:            wp.events,
+		Atomic:            wp.atomic,
+		Revisions:         wp.revisions,
+		FileMode:          wp.fileMode,
+		DirMode:           wp.dirMode,
+		Owner:             wp.owner,
+		KeepExisting:      wp.keepExisting,
+		Prune:             wp.prune,
+		HookCommand:       wp.hookCommand,
+		HookURL:           wp.hookURL,
+		HookTimeout:       wp.hookTimeout,
 	})
 	if err != nil {
 		return err
@@ -112,7 +191,7 @@ func executeWatch(lt upload.LoadType) error {
 
 	err = refresh(fetcher, uploader)
 	if err != nil {
-		log.Errorf("Initial sync failed: %v", err)
+		log.Errorf("Initial sync failed (%s): %v", failureReason(err), err)
 		return err
 	}
 	log.Info("Initial sync succeeded")
@@ -126,7 +205,7 @@ func executeWatch(lt upload.LoadType) error {
 			case <-ticker.C:
 				err := refresh(fetcher, uploader)
 				if err != nil {
-					log.Warnf("Sync failed: %v", err)
+					logSyncFailure(err)
 				}
 			case <-stop:
 				ticker.Stop()
@@ -149,27 +228,57 @@ func executeWatch(lt upload.LoadType) error {
 func refresh(fetcher fetch.Fetcher, uploader upload.Uploader) error {
 	c, err := fetcher.Fetch()
 	if err != nil {
-		writeHealthCheck(nok)
+		writeHealthCheck(nok, fetchFailed)
 		return err
 	}
 
 	iter, err := c.Files()
 	if err != nil {
-		writeHealthCheck(nok)
+		writeHealthCheck(nok, fetchFailed)
 		return err
 	}
 
-	err = uploader.Upload(c.ID().String(), iter)
+	err = uploader.Upload(c, iter)
 	if err != nil {
-		writeHealthCheck(nok)
+		writeHealthCheck(nok, failureReason(err))
 		return err
 	}
 
-	writeHealthCheck(ok)
+	writeHealthCheck(ok, "")
 	return nil
 }
 
-func writeHealthCheck(status healthCheckStatus) {
+// failureReason returns class of the upload failure.
+func failureReason(err error) upload.ErrorReason {
+	var uploadErr *upload.UploadError
+	if errors.As(err, &uploadErr) {
+		return uploadErr.Reason
+	}
+	return upload.ReasonUnknown
+}
+
+func logSyncFailure(err error) {
+	switch failureReason(err) {
+	case upload.ReasonForbidden:
+		log.Errorf("Sync failed, service account is missing RBAC permissions: %v", err)
+	case upload.ReasonUnauthorized:
+		log.Errorf("Sync failed, credentials were rejected by Kubernetes API: %v", err)
+	case upload.ReasonTimeout, upload.ReasonUnavailable:
+		log.Warnf("Sync failed, Kubernetes API is unavailable, will retry: %v", err)
+	case upload.ReasonConflict, upload.ReasonAlreadyExists:
+		log.Warnf("Sync failed, object was modified concurrently, will retry: %v", err)
+	default:
+		log.Warnf("Sync failed: %v", err)
+	}
+}
+
+// writeHealthCheck writes status followed by reason of the failure if there is any.
+func writeHealthCheck(status healthCheckStatus, reason upload.ErrorReason) {
+	content := string(status)
+	if reason != "" {
+		content = fmt.Sprintf("%s %s", status, reason)
+	}
+
 	if wp.healthCheckFile != "" {
 		go func() {
 			dir := path.Dir(wp.healthCheckFile)
@@ -178,7 +287,7 @@ func writeHealthCheck(status healthCheckStatus) {
 				log.Errorf("Unable to create healthcheck folder")
 			}
 
-			err = os.WriteFile(wp.healthCheckFile, []byte(status), 0o600)
+			err = os.WriteFile(wp.healthCheckFile, []byte(content), 0o600)
 			if err != nil {
 				log.Errorf("Unable to write healthcheck file")
 			}
@@ -187,24 +296,44 @@ func writeHealthCheck(status healthCheckStatus) {
 }
 
 func init() {
-	watchCmd.PersistentFlags().StringVar(&wp.healthCheckFile, "healthcheck-file", "", "path to file where each refresh writes if it was successful or not, useful for K8s liveness/readiness probe")
+	watchCmd.PersistentFlags().StringVar(&wp.healthCheckFile, "healthcheck-file", "", "path to file where each refresh writes OK if it was successful or NOK followed by the failure reason otherwise, useful for K8s liveness/readiness probe")
 	watchCmd.PersistentFlags().IntVarP(&wp.interval, "interval", "i", 10, "interval in seconds in which to try refreshing ConfigMap from git")
 	watchCmd.PersistentFlags().StringVarP(&wp.git, "git", "g", "", "git repository address, either http(s) or ssh protocol has to be specified")
 	watchCmd.PersistentFlags().StringVarP(&wp.branch, "branch", "b", "master", "branch name to pull")
 	watchCmd.PersistentFlags().StringVarP(&wp.folder, "cache-folder", "c", "/tmp/git2kube/data/", "destination on filesystem where cache of repository will be stored")
-	watchCmd.PersistentFlags().StringSliceVar(&wp.includes, "include", []string{".*"}, "regex that if is a match includes the file in the upload, example: '*.yaml' or 'folder/*' if you want to match a folder")
-	watchCmd.PersistentFlags().StringSliceVar(&wp.excludes, "exclude", []string{"^\\..*"}, "regex that if is a match excludes the file from the upload, example: '*.yaml' or 'folder/*' if you want to match a folder")
+	watchCmd.PersistentFlags().StringSliceVar(&wp.includes, "include", []string{".*"}, "rule that if is a match includes the file in the upload, regex or glob based on --filter-syntax, example: '\\.yaml$' or '^folder/' as regex, '*.yaml' or 'folder/' as glob (glob default: '**')")
+	watchCmd.PersistentFlags().StringSliceVar(&wp.excludes, "exclude", []string{"^\\..*"}, "rule that if is a match excludes the file from the upload, regex or glob based on --filter-syntax, example: '\\.yaml$' or '^folder/' as regex, '*.yaml' or 'folder/' as glob (glob default: '/.*')")
+	watchCmd.PersistentFlags().StringVar(&wp.filterSyntax, "filter-syntax", string(upload.RegexFilterSyntax), "syntax of --include and --exclude rules, glob rules are gitignore-style with '**' matching any number of directories (options: regex|glob)")
+	watchCmd.PersistentFlags().StringVar(&wp.ignoreFile, "ignore-file", upload.DefaultIgnoreFile, "path of the file in the repository with gitignore-style rules of files excluded from the upload, empty disables it")
+	watchCmd.PersistentFlags().StringSliceVar(&wp.envsubst, "envsubst", []string{}, "regex that if is a match replaces ${VAR} references in the file with values of environment variables allowed by --envsubst-allow, example: '.*\\.conf$'")
+	watchCmd.PersistentFlags().StringSliceVar(&wp.envsubstAllow, "envsubst-allow", []string{}, "name of environment variable that can be substituted in files matched by --envsubst")
+	watchCmd.PersistentFlags().StringSliceVar(&wp.templates, "template", []string{}, "regex that if is a match renders the file as Go template with .Values, .Env (variables allowed by --template-env-allow) and .Commit (Hash, Author, Email, Date, Message) data, example: '.*\\.tmpl$'")
+	watchCmd.PersistentFlags().StringVar(&wp.templateValues, "template-values", "", "path to YAML or JSON file with values available to templates as .Values")
+	watchCmd.PersistentFlags().StringSliceVar(&wp.templateEnvAllow, "template-env-allow", []string{}, "name of environment variable that is available to templates as .Env, other variables can't be read by templates")
+	watchCmd.PersistentFlags().StringSliceVar(&wp.validate, "validate", []string{}, "regex that if is a match validates syntax of the YAML, JSON or TOML file before the upload, invalid file aborts the sync keeping the previous version in target, example: '.*'")
+	watchCmd.PersistentFlags().StringSliceVar(&wp.validateSchemas, "validate-schema", []string{}, "rule validating files matching the regex against JSON Schema stored in the repository (format REGEX=PATH), example: '^apps/.*\\.yaml$=schemas/app.json'")
 	watchCmd.PersistentFlags().StringVarP(&wp.sshkey, "ssh-key", "p", "", "path to the SSH private key (git repository address should be 'git@<address>', example: git@github.com:wandera/git2kube.git)")
 	watchCmd.MarkPersistentFlagRequired("git")              // #nosec G104
 	watchCmd.MarkPersistentFlagFilename("cache-folder")     // #nosec G104
 	watchCmd.MarkPersistentFlagFilename("healthcheck-file") // #nosec G104
+	watchCmd.MarkPersistentFlagFilename("template-values")  // #nosec G104
 
 	watchConfigmapCmd.Flags().BoolVarP(&wp.kubeconfig, "kubeconfig", "k", false, "true if locally stored ~/.kube/config should be used, InCluster config will be used if false (options: true|false) (default: false)")
 	watchConfigmapCmd.Flags().StringVarP(&wp.namespace, "namespace", "n", "default", "target namespace for the resulting ConfigMap")
 	watchConfigmapCmd.Flags().StringVarP(&wp.target, "configmap", "m", "", "name for the resulting ConfigMap")
 	watchConfigmapCmd.Flags().StringSliceVar(&wp.labels, "label", []string{}, "label to add to K8s ConfigMap (format NAME=VALUE)")
 	watchConfigmapCmd.Flags().StringSliceVar(&wp.annotations, "annotation", []string{}, "annotation to add to K8s ConfigMap (format NAME=VALUE)")
-	watchConfigmapCmd.Flags().StringVarP(&wp.mergetype, "merge-type", "", "delete", "how to merge ConfigMap data whether to also delete missing values or just upsert new (options: delete|upsert)")
+	watchConfigmapCmd.Flags().StringVarP(&wp.mergetype, "merge-type", "", "delete", "how to merge ConfigMap data whether to also delete missing values, just upsert new or delete only missing values previously written by git2kube (options: delete|upsert|owned)")
+	watchConfigmapCmd.Flags().StringVar(&wp.keyStrategy, "key-strategy", "path", "how to derive ConfigMap keys from file paths (options: path|basename)")
+	watchConfigmapCmd.Flags().StringVar(&wp.keySeparator, "key-separator", ".", "separator replacing '/' in ConfigMap keys when using path key strategy")
+	watchConfigmapCmd.Flags().StringSliceVar(&wp.keyRenames, "key-rename", []string{}, "regex rename rule applied to file path before deriving ConfigMap key (format REGEX=REPLACEMENT, use \\1 to reference capture groups), example: '^config/(.*)=\\1'")
+	watchConfigmapCmd.Flags().IntVar(&wp.splitDepth, "split-depth", 0, "create one ConfigMap per directory at this depth named by --name-template, ConfigMaps of removed directories are deleted and keys are derived from paths relative to the directory (0 disables splitting)")
+	watchConfigmapCmd.Flags().StringVar(&wp.nameTemplate, "name-template", "{{.Name}}-{{.Dir}}", "Go template of ConfigMap names when using --split-depth with .Name (value of --configmap), .Dir (directory name) and .Path (directory path) data")
+	watchConfigmapCmd.Flags().StringSliceVar(&wp.targetNamespaces, "target-namespace", []string{}, "namespace to replicate the ConfigMap into instead of --namespace, can be combined with --namespace-selector")
+	watchConfigmapCmd.Flags().StringVar(&wp.namespaceSelector, "namespace-selector", "", "label selector of namespaces to replicate the ConfigMap into instead of --namespace, namespaces are listed with every sync, example: 'tenant=true'")
+	watchConfigmapCmd.Flags().BoolVar(&wp.pruneNamespaces, "prune-namespaces", false, "delete ConfigMap copies from namespaces that are no longer selected by --target-namespace or --namespace-selector")
+	watchConfigmapCmd.Flags().StringVar(&wp.ownerReference, "owner-reference", "", "owner of created ConfigMaps so that they are deleted with it, either KIND/NAME of Deployment, StatefulSet or DaemonSet in --namespace or 'auto' to use controller of the running pod identified by POD_NAME and POD_NAMESPACE environment variables (Deployment or CronJob of its ReplicaSet or Job), the owner has to be in --namespace")
+	watchConfigmapCmd.Flags().BoolVar(&wp.events, "events", false, "record Kubernetes Events about failed syncs and syncs that changed data on the synced ConfigMaps and on the pod identified by POD_NAME and POD_NAMESPACE environment variables")
 	watchConfigmapCmd.MarkFlagFilename("kubeconfig") // #nosec G104
 	watchConfigmapCmd.MarkFlagRequired("configmap")  // #nosec G104
 
@@ -213,15 +342,53 @@ func init() {
 	watchSecretCmd.Flags().StringVarP(&wp.target, "secret", "s", "", "name for the resulting Secret")
 	watchSecretCmd.Flags().StringSliceVar(&wp.labels, "label", []string{}, "label to add to K8s Secret (format NAME=VALUE)")
 	watchSecretCmd.Flags().StringSliceVar(&wp.annotations, "annotation", []string{}, "annotation to add to K8s Secret (format NAME=VALUE)")
-	watchSecretCmd.Flags().StringVarP(&wp.mergetype, "merge-type", "", "delete", "how to merge Secret data whether to also delete missing values or just upsert new (options: delete|upsert)")
-	watchSecretCmd.MarkFlagFilename("kubeconfig") // #nosec G104
-	watchSecretCmd.MarkFlagRequired("secret")     // #nosec G104
+	watchSecretCmd.Flags().StringVarP(&wp.mergetype, "merge-type", "", "delete", "how to merge Secret data whether to also delete missing values, just upsert new or delete only missing values previously written by git2kube (options: delete|upsert|owned)")
+	watchSecretCmd.Flags().StringVar(&wp.ageKeyFile, "age-key-file", "", "path to file with age identities used to decrypt SOPS and age encrypted files, SOPS_AGE_KEY_FILE and SOPS_AGE_KEY environment variables are used as fallback")
+	watchSecretCmd.Flags().StringSliceVar(&wp.ageDecrypt, "age-decrypt", []string{}, "regex that if is a match decrypts the file with age identities and strips the .age suffix from its name, example: '.*\\.age$'")
+	watchSecretCmd.Flags().StringVar(&wp.keyStrategy, "key-strategy", "path", "how to derive Secret keys from file paths (options: path|basename)")
+	watchSecretCmd.Flags().StringVar(&wp.keySeparator, "key-separator", ".", "separator replacing '/' in Secret keys when using path key strategy")
+	watchSecretCmd.Flags().StringSliceVar(&wp.keyRenames, "key-rename", []string{}, "regex rename rule applied to file path before deriving Secret key (format REGEX=REPLACEMENT, use \\1 to reference capture groups), example: '^config/(.*)=\\1'")
+	watchSecretCmd.Flags().IntVar(&wp.splitDepth, "split-depth", 0, "create one Secret per directory at this depth named by --name-template, Secrets of removed directories are deleted and keys are derived from paths relative to the directory (0 disables splitting)")
+	watchSecretCmd.Flags().StringVar(&wp.nameTemplate, "name-template", "{{.Name}}-{{.Dir}}", "Go template of Secret names when using --split-depth with .Name (value of --secret), .Dir (directory name) and .Path (directory path) data")
+	watchSecretCmd.Flags().StringSliceVar(&wp.targetNamespaces, "target-namespace", []string{}, "namespace to replicate the Secret into instead of --namespace, can be combined with --namespace-selector")
+	watchSecretCmd.Flags().StringVar(&wp.namespaceSelector, "namespace-selector", "", "label selector of namespaces to replicate the Secret into instead of --namespace, namespaces are listed with every sync, example: 'tenant=true'")
+	watchSecretCmd.Flags().BoolVar(&wp.pruneNamespaces, "prune-namespaces", false, "delete Secret copies from namespaces that are no longer selected by --target-namespace or --namespace-selector")
+	watchSecretCmd.Flags().StringVar(&wp.ownerReference, "owner-reference", "", "owner of created Secrets so that they are deleted with it, either KIND/NAME of Deployment, StatefulSet or DaemonSet in --namespace or 'auto' to use controller of the running pod identified by POD_NAME and POD_NAMESPACE environment variables (Deployment or CronJob of its ReplicaSet or Job), the owner has to be in --namespace")
+	watchSecretCmd.Flags().BoolVar(&wp.events, "events", false, "record Kubernetes Events about failed syncs and syncs that changed data on the synced Secrets and on the pod identified by POD_NAME and POD_NAMESPACE environment variables")
+	watchSecretCmd.MarkFlagFilename("kubeconfig")   // #nosec G104
+	watchSecretCmd.MarkFlagRequired("secret")       // #nosec G104
+	watchSecretCmd.MarkFlagFilename("age-key-file") // #nosec G104
 
 	watchFolderCmd.Flags().StringVarP(&wp.target, "target-folder", "t", "", "path to target folder")
+	watchFolderCmd.Flags().StringVar(&wp.ageKeyFile, "age-key-file", "", "path to file with age identities used to decrypt age encrypted files, SOPS_AGE_KEY_FILE and SOPS_AGE_KEY environment variables are used as fallback")
+	watchFolderCmd.Flags().StringSliceVar(&wp.ageDecrypt, "age-decrypt", []string{}, "regex that if is a match decrypts the file with age identities and strips the .age suffix from its name, example: '.*\\.age$'")
+	watchFolderCmd.Flags().BoolVar(&wp.atomic, "atomic", false, "write each revision into a new folder and atomically switch the 'current' symlink in target folder to it, consumers should read from '<target-folder>/current'")
+	watchFolderCmd.Flags().IntVar(&wp.revisions, "keep-revisions", 1, "number of previous revisions to keep in target folder when using atomic updates")
+	watchFolderCmd.Flags().StringVar(&wp.fileMode, "file-mode", "0644", "octal permissions of written files, executable files from repository get execute bit wherever read bit is set")
+	watchFolderCmd.Flags().StringVar(&wp.dirMode, "dir-mode", "0755", "octal permissions of created folders")
+	watchFolderCmd.Flags().StringVar(&wp.owner, "owner", "", "owner of written files and folders (format UID:GID), current user if not set")
+	watchFolderCmd.Flags().BoolVar(&wp.keepExisting, "keep-existing", false, "keep existing content of target folder on startup and reconcile it with the first sync instead of removing it")
+	watchFolderCmd.Flags().StringVar(&wp.hookCommand, "hook-command", "", "shell command run after a sync that changed files, GIT2KUBE_COMMIT, GIT2KUBE_TARGET and newline separated GIT2KUBE_CHANGED_FILES environment variables are set")
+	watchFolderCmd.Flags().StringVar(&wp.hookURL, "hook-url", "", "URL that receives a JSON POST request with commit, target and changed files after a sync that changed files")
+	watchFolderCmd.Flags().DurationVar(&wp.hookTimeout, "hook-timeout", 30*time.Second, "timeout of the post-sync hook, failed hooks are retried with the next sync")
 	watchFolderCmd.MarkFlagRequired("target-folder") // #nosec G104
 	watchFolderCmd.MarkFlagFilename("target-folder") // #nosec G104
+	watchFolderCmd.MarkFlagFilename("age-key-file")  // #nosec G104
+
+	watchManifestsCmd.Flags().BoolVarP(&wp.kubeconfig, "kubeconfig", "k", false, "true if locally stored ~/.kube/config should be used, InCluster config will be used if false (options: true|false) (default: false)")
+	watchManifestsCmd.Flags().StringVarP(&wp.namespace, "namespace", "n", "default", "namespace of the inventory ConfigMap and of namespaced objects that do not specify one")
+	watchManifestsCmd.Flags().StringVar(&wp.target, "inventory", "", "name of the ConfigMap tracking applied objects, used for pruning")
+	watchManifestsCmd.Flags().StringSliceVar(&wp.labels, "label", []string{}, "label to add to applied K8s objects (format NAME=VALUE)")
+	watchManifestsCmd.Flags().StringSliceVar(&wp.annotations, "annotation", []string{}, "annotation to add to applied K8s objects (format NAME=VALUE)")
+	watchManifestsCmd.Flags().StringVar(&wp.ageKeyFile, "age-key-file", "", "path to file with age identities used to decrypt SOPS and age encrypted files, SOPS_AGE_KEY_FILE and SOPS_AGE_KEY environment variables are used as fallback")
+	watchManifestsCmd.Flags().StringSliceVar(&wp.ageDecrypt, "age-decrypt", []string{}, "regex that if is a match decrypts the file with age identities and strips the .age suffix from its name, example: '.*\\.age$'")
+	watchManifestsCmd.Flags().BoolVar(&wp.prune, "prune", true, "delete previously applied objects that are no longer present in the repository")
+	watchManifestsCmd.MarkFlagFilename("kubeconfig")   // #nosec G104
+	watchManifestsCmd.MarkFlagRequired("inventory")    // #nosec G104
+	watchManifestsCmd.MarkFlagFilename("age-key-file") // #nosec G104
 
 	watchCmd.AddCommand(watchConfigmapCmd)
 	watchCmd.AddCommand(watchSecretCmd)
 	watchCmd.AddCommand(watchFolderCmd)
+	watchCmd.AddCommand(watchManifestsCmd)
 }
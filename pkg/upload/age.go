@@ -0,0 +1,99 @@
+package upload
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ageKeyEnv     = "SOPS_AGE_KEY"
+	ageKeyFileEnv = "SOPS_AGE_KEY_FILE"
+	ageSuffix     = ".age"
+)
+
+// ageDecrypter decrypts age encrypted files matching patterns and strips the .age suffix from their names.
+type ageDecrypter struct {
+	patterns   []*regexp.Regexp
+	identities []age.Identity
+}
+
+func newAgeDecrypter(patterns []*regexp.Regexp, identities []age.Identity) *ageDecrypter {
+	return &ageDecrypter{
+		patterns:   patterns,
+		identities: identities,
+	}
+}
+
+func (d *ageDecrypter) transform(_ *object.Commit, file *object.File) (*object.File, error) {
+	if !matchesAny(file.Name, d.patterns) {
+		return file, nil
+	}
+
+	reader, err := file.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	buffered := bufio.NewReader(reader)
+	var src io.Reader = buffered
+	if header, _ := buffered.Peek(len(armor.Header)); string(header) == armor.Header {
+		src = armor.NewReader(buffered)
+	}
+
+	decrypted, err := age.Decrypt(src, d.identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt age file '%s': %w", file.Name, err)
+	}
+
+	content, err := io.ReadAll(decrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt age file '%s': %w", file.Name, err)
+	}
+	log.Debugf("Decrypted age file '%s'", file.Name)
+
+	return newMemoryFile(strings.TrimSuffix(file.Name, ageSuffix), file.Mode, content)
+}
+
+// loadAgeIdentities loads age identities from keyFile, falling back to SOPS_AGE_KEY_FILE
+// and SOPS_AGE_KEY environment variables. No identities and no error are returned if none is configured.
+func loadAgeIdentities(keyFile string) ([]age.Identity, error) {
+	var identities []age.Identity
+
+	if keyFile == "" {
+		keyFile = os.Getenv(ageKeyFileEnv)
+	}
+	if keyFile != "" {
+		f, err := os.Open(keyFile) // #nosec G304
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		ids, err := age.ParseIdentities(f)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, ids...)
+	}
+
+	if key := os.Getenv(ageKeyEnv); key != "" {
+		ids, err := age.ParseIdentities(strings.NewReader(key))
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, ids...)
+	}
+
+	log.Infof("Loaded %d age identities", len(identities))
+	return identities, nil
+}
@@ -0,0 +1,117 @@
+package upload
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestAgeDecrypter_Transform(t *testing.T) {
+	identities, err := loadAgeIdentities("testdata/age.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patterns := []*regexp.Regexp{regexp.MustCompile(`\.age$`)}
+
+	cases := []struct {
+		name       string
+		file       string
+		identities []age.Identity
+		result     string
+		content    string
+		err        bool
+	}{
+		{
+			name:       "Binary age file",
+			file:       "secret.txt.age",
+			identities: identities,
+			result:     "secret.txt",
+			content:    "top secret\n",
+		},
+		{
+			name:       "Armored age file",
+			file:       "armored.txt.age",
+			identities: identities,
+			result:     "armored.txt",
+			content:    "top secret\n",
+		},
+		{
+			name:       "Not matching file",
+			file:       "test.json",
+			identities: identities,
+			result:     "test.json",
+		},
+		{
+			name: "Age file without identities",
+			file: "secret.txt.age",
+			err:  true,
+		},
+	}
+
+	for _, c := range cases {
+		content, err := os.ReadFile(filepath.Join("testdata", c.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := newMemoryFile(c.file, filemode.Regular, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := newAgeDecrypter(patterns, c.identities).transform(testCommit, file)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s case failed: expected error but got none", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s case failed: %v", c.name, err)
+			continue
+		}
+
+		if res.Name != c.result {
+			t.Errorf("%s case failed: expected name '%s' but got '%s' instead", c.name, c.result, res.Name)
+		}
+		if c.content != "" {
+			if decrypted, _ := res.Contents(); decrypted != c.content {
+				t.Errorf("%s case failed: expected content '%s' but got '%s' instead", c.name, c.content, decrypted)
+			}
+		}
+	}
+}
+
+func TestFolderUploader_UploadAge(t *testing.T) {
+	identities, err := loadAgeIdentities("testdata/age.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := t.TempDir()
+	cu := &folderUploader{
+		name:         target,
+		includes:     []*regexp.Regexp{regexp.MustCompile(".*")},
+		transformers: []transformer{newAgeDecrypter([]*regexp.Regexp{regexp.MustCompile(`\.age$`)}, identities)},
+	}
+	iter := &mockFileIter{files: []*object.File{object.NewFile("secret.txt.age", filemode.Regular, &object.Blob{})}}
+
+	if err := cu.Upload(testCommit, iter); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(target, "secret.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "top secret\n" {
+		t.Errorf("expected decrypted content but got '%s' instead", content)
+	}
+	if _, err := os.Stat(filepath.Join(target, "secret.txt.age")); !os.IsNotExist(err) {
+		t.Errorf("encrypted file should not be written to target")
+	}
+}
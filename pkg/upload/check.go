@@ -0,0 +1,246 @@
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Problem issue found in the working copy, File is empty for issues of the whole target.
+type Problem struct {
+	File    string
+	Message string
+}
+
+// Report result of the working copy check.
+type Report struct {
+	// Files number of files that would be uploaded
+	Files int
+	// Size total size of the uploaded data
+	Size     int
+	Problems []Problem
+}
+
+func (r *Report) add(file string, err error) {
+	r.Problems = append(r.Problems, Problem{File: file, Message: err.Error()})
+}
+
+// Check runs filtering, key naming and validation of the load type on files in the local folder without cloning
+// the repository or connecting to the cluster, all problems are reported instead of stopping at the first one.
+// Files decrypted with age or rendered during the sync by templates or environment substitution are not validated
+// as their content is known only in the target environment, age suffix is stripped from names the same way.
+func Check(lt LoadType, folder string, o UploaderOptions) (*Report, error) {
+	includesRegex, err := compileFilters(o.FilterSyntax, o.Includes)
+	if err != nil {
+		return nil, err
+	}
+
+	excludesRegex, err := compileFilters(o.FilterSyntax, o.Excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	validateRegex, err := stringsToRegExp(o.Validate)
+	if err != nil {
+		return nil, err
+	}
+
+	validator, err := newValidator(validateRegex, o.ValidateSchemas)
+	if err != nil {
+		return nil, err
+	}
+
+	ageDecryptRegex, err := stringsToRegExp(o.AgeDecrypt)
+	if err != nil {
+		return nil, err
+	}
+
+	templatesRegex, err := stringsToRegExp(o.Templates)
+	if err != nil {
+		return nil, err
+	}
+
+	envsubstRegex, err := stringsToRegExp(o.Envsubst)
+	if err != nil {
+		return nil, err
+	}
+	rendered := append(templatesRegex, envsubstRegex...)
+
+	keys, err := newKeyNamer(o.KeyStrategy, o.KeySeparator, o.KeyRenames)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.SplitDepth > 0 && o.Target == "" {
+		return nil, errors.New("target name is required to resolve names of split targets")
+	}
+	targets, err := newFanout(o.SplitDepth, o.NameTemplate, o.Target)
+	if err != nil {
+		return nil, err
+	}
+	resolver := targets.resolver()
+
+	files := folderFiles(folder)
+	ignore, err := readIgnoreRules(o.IgnoreFile, files)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	sources := make(map[string]keySources)
+	sizes := make(map[string]int)
+	links := make(map[string]string)
+	err = folderIter{root: folder}.ForEach(func(file *object.File) error {
+		if !filterFile(file, includesRegex, excludesRegex, ignore) {
+			return nil
+		}
+
+		content, err := file.Contents()
+		if err != nil {
+			return err
+		}
+
+		name := file.Name
+		encrypted := matchesAny(file.Name, ageDecryptRegex)
+		if encrypted {
+			name = strings.TrimSuffix(name, ageSuffix)
+		}
+
+		switch lt {
+		case ConfigMap, Secret:
+			target, path, ok, err := resolver.target(o.Target, name)
+			if err != nil {
+				report.add(file.Name, err)
+				return nil
+			}
+			if !ok {
+				return nil
+			}
+			sizes[target] += len(content)
+			if key, err := keys.key(path); err != nil {
+				report.add(file.Name, err)
+			} else {
+				if sources[target] == nil {
+					sources[target] = make(keySources)
+				}
+				sources[target].add(key, file.Name)
+			}
+			if lt == ConfigMap && !utf8.ValidString(content) {
+				report.add(file.Name, fmt.Errorf("file '%s' is not valid UTF-8 text, binary files can be synchronised only into Secret", file.Name))
+			}
+		case Folder:
+			if err := checkFilePath(file); err != nil {
+				report.add(file.Name, err)
+			} else if file.Mode == filemode.Symlink {
+				links[file.Name] = content
+			}
+		}
+		report.Files++
+		report.Size += len(content)
+
+		switch {
+		case encrypted:
+			log.Debugf("Skipping validation of '%s', it is decrypted during the sync", file.Name)
+			return nil
+		case matchesAny(name, rendered):
+			log.Debugf("Skipping validation of '%s', it is rendered during the sync", file.Name)
+			return nil
+		}
+		if err := validator.validate(folder, files, file); err != nil {
+			report.add(file.Name, err)
+		}
+		if lt == Manifests && isManifestFile(file.Name) {
+			if _, err := parseManifests(file); err != nil {
+				report.add(file.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	symlinkErrs := checkSymlinks(links)
+	for _, name := range sortedTargets(symlinkErrs) {
+		report.add(name, symlinkErrs[name])
+	}
+	for _, name := range sortedTargets(sources) {
+		if err := sources[name].collisions(); err != nil {
+			report.add("", err)
+		}
+	}
+	for _, name := range sortedTargets(sizes) {
+		if sizes[name] > corev1.MaxSecretSize {
+			report.add("", fmt.Errorf("total size %d bytes of '%s' exceeds the limit of %d bytes", sizes[name], name, corev1.MaxSecretSize))
+		}
+	}
+
+	return report, nil
+}
+
+// folderIter iterates files of the local working copy, the .git folder is skipped.
+type folderIter struct {
+	root string
+}
+
+func (i folderIter) ForEach(cb func(*object.File) error) error {
+	return filepath.WalkDir(i.root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(i.root, name)
+		if err != nil {
+			return err
+		}
+
+		var (
+			mode    filemode.FileMode
+			content []byte
+		)
+		switch {
+		case entry.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(name)
+			if err != nil {
+				return err
+			}
+			mode, content = filemode.Symlink, []byte(filepath.ToSlash(target))
+		case entry.Type().IsRegular():
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			mode = filemode.Regular
+			if info.Mode()&0o111 != 0 {
+				mode = filemode.Executable
+			}
+			content, err = os.ReadFile(name) // #nosec G304
+			if err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+
+		file, err := newMemoryFile(filepath.ToSlash(rel), mode, content)
+		if err != nil {
+			return err
+		}
+		return cb(file)
+	})
+}
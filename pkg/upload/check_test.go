@@ -0,0 +1,191 @@
+package upload
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFolder(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestCheck(t *testing.T) {
+	folder := writeFolder(t, map[string]string{
+		".git/config":           "[core",
+		".git2kubeignore":       "broken.json\n",
+		"schemas/app.yaml":      appSchema,
+		"schemas/replicas.json": `{"type": "integer", "minimum": 1}`,
+		"apps/a/config.yaml":    "name: a\n",
+		"apps/b/config.yaml":    "replicas: 1\n",
+		"broken.json":           "{\n  \"a\": }\n",
+		"binary.dat":            "\xff\xfe",
+		"manifests/cm.yaml":     "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n",
+		"manifests/bad.yaml":    "kind: [",
+		"manifests/notes.txt":   "notes",
+		"teams/a/config.yaml":   "name: a\n",
+		"teams/b/config.yaml":   "name: b\n",
+		"teams/b/app.yaml":      "{{- if .Values.name }}\nname: {{ .Values.name }}\n{{- end }}\n",
+		"teams/config.yaml":     "name: root\n",
+		"secrets/token":         "token",
+		"secrets/token.age":     "age-encryption.org/v1\n",
+		"secrets/key.yaml.age":  "age-encryption.org/v1\n",
+	})
+
+	cases := []struct {
+		name     string
+		lt       LoadType
+		options  UploaderOptions
+		files    int
+		problems []string
+		err      bool
+	}{
+		{
+			name: "ConfigMap",
+			lt:   ConfigMap,
+			options: UploaderOptions{
+				Includes:        []string{"^apps/", "^binary", "^broken"},
+				Validate:        []string{".*"},
+				ValidateSchemas: []string{"^apps/=schemas/app.yaml"},
+				KeyStrategy:     BasenameKeyStrategy,
+			},
+			files: 4,
+			problems: []string{
+				"apps/b/config.yaml: file 'apps/b/config.yaml' does not match schema 'schemas/app.yaml' at line 1 ('/'): missing property 'name'",
+				"binary.dat: file 'binary.dat' is not valid UTF-8 text",
+				"broken.json: invalid JSON file 'broken.json' at line 2",
+				": key collisions detected: 'config.yaml' <- ['apps/a/config.yaml', 'apps/b/config.yaml']",
+			},
+		},
+		{
+			name: "Split ConfigMaps",
+			lt:   ConfigMap,
+			options: UploaderOptions{
+				Target:       "git2kube",
+				Includes:     []string{"^teams/"},
+				Validate:     []string{".*"},
+				Templates:    []string{"^teams/b/app\\.yaml$"},
+				KeyStrategy:  BasenameKeyStrategy,
+				SplitDepth:   2,
+				NameTemplate: "{{.Name}}-{{.Dir}}",
+			},
+			files: 3,
+		},
+		{
+			name: "Split ConfigMaps without name",
+			lt:   ConfigMap,
+			options: UploaderOptions{
+				Includes:   []string{"^teams/"},
+				SplitDepth: 2,
+			},
+			err: true,
+		},
+		{
+			name: "Secret",
+			lt:   Secret,
+			options: UploaderOptions{
+				Includes: []string{"^binary"},
+			},
+			files: 1,
+		},
+		{
+			name: "Age decrypted Secret",
+			lt:   Secret,
+			options: UploaderOptions{
+				Includes:   []string{"^secrets/"},
+				Validate:   []string{".*"},
+				AgeDecrypt: []string{"\\.age$"},
+			},
+			files: 3,
+			problems: []string{
+				": key collisions detected: 'secrets.token' <- ['secrets/token', 'secrets/token.age']",
+			},
+		},
+		{
+			name: "Ignore file",
+			lt:   Secret,
+			options: UploaderOptions{
+				Includes:   []string{"^binary", "^broken"},
+				Validate:   []string{".*"},
+				IgnoreFile: DefaultIgnoreFile,
+			},
+			files: 1,
+		},
+		{
+			name: "Manifests",
+			lt:   Manifests,
+			options: UploaderOptions{
+				Includes: []string{"^manifests/"},
+			},
+			files: 3,
+			problems: []string{
+				"manifests/bad.yaml: ",
+			},
+		},
+		{
+			name: "Git folder skipped",
+			lt:   Folder,
+			options: UploaderOptions{
+				Includes: []string{".*"},
+				Excludes: []string{"^(apps|manifests|schemas|secrets|teams)/", "^b", "^\\.git2kubeignore$"},
+			},
+			files: 0,
+		},
+	}
+
+	for _, c := range cases {
+		report, err := Check(c.lt, folder, c.options)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s case failed: expected error", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s case failed: %v", c.name, err)
+		}
+		if report.Files != c.files {
+			t.Errorf("%s case failed: expected %d files but got %d instead", c.name, c.files, report.Files)
+		}
+
+		problems := make([]string, len(report.Problems))
+		for i, p := range report.Problems {
+			problems[i] = p.File + ": " + p.Message
+		}
+		matched := len(problems) == len(c.problems)
+		for i := 0; matched && i < len(problems); i++ {
+			matched = strings.HasPrefix(problems[i], c.problems[i])
+		}
+		if !matched {
+			t.Errorf("%s case failed: expected problems %q but got %q instead", c.name, c.problems, problems)
+		}
+	}
+}
+
+func TestCheck_SizeLimit(t *testing.T) {
+	folder := writeFolder(t, map[string]string{
+		"big": strings.Repeat("a", 1024*1024+1),
+	})
+
+	report, err := Check(Secret, folder, UploaderOptions{Target: "git2kube", Includes: []string{".*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Problem{{Message: "total size 1048577 bytes of 'git2kube' exceeds the limit of 1048576 bytes"}}
+	if !reflect.DeepEqual(report.Problems, expected) {
+		t.Errorf("expected problems %v but got %v instead", expected, report.Problems)
+	}
+}
@@ -0,0 +1,60 @@
+package upload
+
+import (
+	"os"
+	"regexp"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+)
+
+// envReference matches ${VAR} references, plain $VAR is left alone as it is common in configs (e.g. $labels in Prometheus rules).
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// envSubstituter replaces ${VAR} references in files matching patterns with values of allowed environment variables.
+type envSubstituter struct {
+	patterns []*regexp.Regexp
+	allowed  map[string]bool
+}
+
+func newEnvSubstituter(patterns []*regexp.Regexp, allowed []string) *envSubstituter {
+	if len(patterns) > 0 && len(allowed) == 0 {
+		log.Warn("No environment variables allowed for substitution, files will be uploaded unchanged")
+	}
+
+	allowedMap := make(map[string]bool)
+	for _, name := range allowed {
+		allowedMap[name] = true
+	}
+
+	return &envSubstituter{
+		patterns: patterns,
+		allowed:  allowedMap,
+	}
+}
+
+func (s *envSubstituter) transform(_ *object.Commit, file *object.File) (*object.File, error) {
+	if !matchesAny(file.Name, s.patterns) {
+		return file, nil
+	}
+
+	content, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	result := envReference.ReplaceAllStringFunc(content, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		if !s.allowed[name] {
+			log.Debugf("Variable '%s' in '%s' is not allowed, skipping", name, file.Name)
+			return ref
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			log.Warnf("Variable '%s' in '%s' is not set, substituting empty value", name, file.Name)
+		}
+		return value
+	})
+
+	return newMemoryFile(file.Name, file.Mode, []byte(result))
+}
@@ -0,0 +1,77 @@
+package upload
+
+import (
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+)
+
+func TestEnvSubstituter_Transform(t *testing.T) {
+	os.Setenv("GIT2KUBE_TEST_HOST", "example.com")
+	os.Setenv("GIT2KUBE_TEST_PASSWORD", "s3cr3t")
+	defer os.Unsetenv("GIT2KUBE_TEST_HOST")
+	defer os.Unsetenv("GIT2KUBE_TEST_PASSWORD")
+
+	cases := []struct {
+		name    string
+		file    string
+		allowed []string
+		content string
+		result  string
+	}{
+		{
+			name:    "Allowed variable",
+			file:    "app.conf",
+			allowed: []string{"GIT2KUBE_TEST_HOST"},
+			content: "host=${GIT2KUBE_TEST_HOST}",
+			result:  "host=example.com",
+		},
+		{
+			name:    "Not allowed variable",
+			file:    "app.conf",
+			allowed: []string{"GIT2KUBE_TEST_HOST"},
+			content: "host=${GIT2KUBE_TEST_HOST} password=${GIT2KUBE_TEST_PASSWORD}",
+			result:  "host=example.com password=${GIT2KUBE_TEST_PASSWORD}",
+		},
+		{
+			name:    "Unset variable",
+			file:    "app.conf",
+			allowed: []string{"GIT2KUBE_TEST_UNSET"},
+			content: "value=${GIT2KUBE_TEST_UNSET}",
+			result:  "value=",
+		},
+		{
+			name:    "Variable without braces",
+			file:    "app.conf",
+			allowed: []string{"GIT2KUBE_TEST_HOST"},
+			content: "host=$GIT2KUBE_TEST_HOST",
+			result:  "host=$GIT2KUBE_TEST_HOST",
+		},
+		{
+			name:    "Not matching file",
+			file:    "app.yaml",
+			allowed: []string{"GIT2KUBE_TEST_HOST"},
+			content: "host=${GIT2KUBE_TEST_HOST}",
+			result:  "host=${GIT2KUBE_TEST_HOST}",
+		},
+	}
+
+	for _, c := range cases {
+		file, err := newMemoryFile(c.file, filemode.Regular, []byte(c.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := newEnvSubstituter([]*regexp.Regexp{regexp.MustCompile(`\.conf$`)}, c.allowed).transform(testCommit, file)
+		if err != nil {
+			t.Errorf("%s case failed: %v", c.name, err)
+			continue
+		}
+
+		if substituted, _ := res.Contents(); substituted != c.result {
+			t.Errorf("%s case failed: expected '%s' but got '%s' instead", c.name, c.result, substituted)
+		}
+	}
+}
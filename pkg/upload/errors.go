@@ -0,0 +1,95 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// ErrorReason class of the failure reported by Kubernetes API.
+type ErrorReason string
+
+// ErrorReason options enum.
+const (
+	// ReasonForbidden missing RBAC permissions.
+	ReasonForbidden ErrorReason = "Forbidden"
+	// ReasonUnauthorized invalid or expired credentials.
+	ReasonUnauthorized ErrorReason = "Unauthorized"
+	// ReasonTimeout request timed out.
+	ReasonTimeout ErrorReason = "Timeout"
+	// ReasonUnavailable API server is not reachable or overloaded.
+	ReasonUnavailable ErrorReason = "Unavailable"
+	// ReasonConflict object was modified concurrently.
+	ReasonConflict ErrorReason = "Conflict"
+	// ReasonAlreadyExists object was created concurrently.
+	ReasonAlreadyExists ErrorReason = "AlreadyExists"
+	// ReasonNotFound object or namespace does not exist.
+	ReasonNotFound ErrorReason = "NotFound"
+	// ReasonInvalid object was rejected by validation.
+	ReasonInvalid ErrorReason = "Invalid"
+	// ReasonUnknown any other failure.
+	ReasonUnknown ErrorReason = "Unknown"
+)
+
+// UploadError failed operation on Kubernetes object.
+type UploadError struct {
+	Reason    ErrorReason
+	Operation string
+	Kind      string
+	Namespace string
+	Name      string
+	Err       error
+}
+
+func (e *UploadError) Error() string {
+	if e.Namespace == "" {
+		return fmt.Sprintf("failed to %s %s '%s' (%s): %v", e.Operation, e.Kind, e.Name, e.Reason, e.Err)
+	}
+	return fmt.Sprintf("failed to %s %s '%s.%s' (%s): %v", e.Operation, e.Kind, e.Namespace, e.Name, e.Reason, e.Err)
+}
+
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+// newUploadError wraps err of the operation on object, nil is returned if err is nil.
+func newUploadError(operation string, kind string, namespace string, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &UploadError{
+		Reason:    classifyError(err),
+		Operation: operation,
+		Kind:      kind,
+		Namespace: namespace,
+		Name:      name,
+		Err:       err,
+	}
+}
+
+// classifyError returns reason of the Kubernetes API error.
+func classifyError(err error) ErrorReason {
+	switch {
+	case k8serrors.IsForbidden(err):
+		return ReasonForbidden
+	case k8serrors.IsUnauthorized(err):
+		return ReasonUnauthorized
+	case k8serrors.IsTimeout(err), k8serrors.IsServerTimeout(err), errors.Is(err, context.DeadlineExceeded), utilnet.IsTimeout(err):
+		return ReasonTimeout
+	case k8serrors.IsServiceUnavailable(err), k8serrors.IsTooManyRequests(err), k8serrors.IsInternalError(err), utilnet.IsConnectionRefused(err), utilnet.IsConnectionReset(err), utilnet.IsProbableEOF(err):
+		return ReasonUnavailable
+	case k8serrors.IsConflict(err):
+		return ReasonConflict
+	case k8serrors.IsAlreadyExists(err):
+		return ReasonAlreadyExists
+	case k8serrors.IsNotFound(err):
+		return ReasonNotFound
+	case k8serrors.IsInvalid(err):
+		return ReasonInvalid
+	default:
+		return ReasonUnknown
+	}
+}
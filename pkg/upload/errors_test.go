@@ -0,0 +1,68 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	testing2 "k8s.io/client-go/testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	resource := schema.GroupResource{Resource: "configmaps"}
+	cases := []struct {
+		name   string
+		err    error
+		reason ErrorReason
+	}{
+		{name: "Forbidden", err: k8serrors.NewForbidden(resource, "git2kube", errors.New("rbac")), reason: ReasonForbidden},
+		{name: "Unauthorized", err: k8serrors.NewUnauthorized("expired"), reason: ReasonUnauthorized},
+		{name: "Timeout", err: k8serrors.NewTimeoutError("slow", 1), reason: ReasonTimeout},
+		{name: "Deadline", err: fmt.Errorf("get: %w", context.DeadlineExceeded), reason: ReasonTimeout},
+		{name: "Unavailable", err: k8serrors.NewServiceUnavailable("down"), reason: ReasonUnavailable},
+		{name: "Conflict", err: k8serrors.NewConflict(resource, "git2kube", errors.New("modified")), reason: ReasonConflict},
+		{name: "Already exists", err: k8serrors.NewAlreadyExists(resource, "git2kube"), reason: ReasonAlreadyExists},
+		{name: "Not found", err: k8serrors.NewNotFound(resource, "git2kube"), reason: ReasonNotFound},
+		{name: "Unknown", err: errors.New("boom"), reason: ReasonUnknown},
+	}
+
+	for _, c := range cases {
+		if reason := classifyError(c.err); reason != c.reason {
+			t.Errorf("%s case failed: expected reason '%s' but got '%s' instead", c.name, c.reason, reason)
+		}
+	}
+}
+
+func TestConfigmapUploader_UploadGetError(t *testing.T) {
+	fakeclient := testclient.NewSimpleClientset()
+	fakeclient.PrependReactor("get", "configmaps", func(action testing2.Action) (bool, runtime.Object, error) {
+		return true, nil, k8serrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "git2kube", errors.New("rbac"))
+	})
+
+	cu := &configmapUploader{
+		clientset:   fakeclient,
+		namespace:   "default",
+		name:        "git2kube",
+		labels:      map[string]string{},
+		annotations: map[string]string{},
+	}
+	err := cu.Upload(testCommit, &mockFileIter{})
+
+	var uploadErr *UploadError
+	if !errors.As(err, &uploadErr) {
+		t.Fatalf("expected UploadError but got %v", err)
+	}
+	if uploadErr.Reason != ReasonForbidden || uploadErr.Operation != "get" {
+		t.Errorf("expected forbidden get but got %v", uploadErr)
+	}
+	for _, action := range fakeclient.Actions() {
+		if action.GetVerb() == "create" {
+			t.Errorf("create should not be attempted when get fails")
+		}
+	}
+}
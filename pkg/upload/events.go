@@ -0,0 +1,134 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcore "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	eventComponent = "git2kube"
+
+	// reasonSynced reason of the event recorded after successful sync.
+	reasonSynced = "Synced"
+	// reasonSyncFailed reason of the event recorded after failed sync.
+	reasonSyncFailed = "SyncFailed"
+)
+
+// eventRecorder records results of the sync as Kubernetes Events on the synced objects and on the watcher pod.
+type eventRecorder struct {
+	recorder record.EventRecorder
+	pod      *corev1.ObjectReference
+}
+
+// newEventRecorder creates recorder sending events through clientset, nil is returned if not enabled.
+// Events are recorded on the watcher pod only if it is identified by POD_NAME and POD_NAMESPACE environment variables.
+func newEventRecorder(clientset kubernetes.Interface, enabled bool) *eventRecorder {
+	if !enabled {
+		return nil
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcore.EventSinkImpl{Interface: clientset.CoreV1().Events(metav1.NamespaceAll)})
+
+	return &eventRecorder{
+		recorder: broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventComponent}),
+		pod:      podReference(clientset),
+	}
+}
+
+// podReference returns reference to the running pod, nil is returned if it can't be resolved.
+func podReference(clientset kubernetes.Interface) *corev1.ObjectReference {
+	name, namespace := os.Getenv(podNameEnv), os.Getenv(podNamespaceEnv)
+	if name == "" || namespace == "" {
+		log.Infof("%s and %s environment variables are not set, events won't be recorded on the pod", podNameEnv, podNamespaceEnv)
+		return nil
+	}
+
+	pod, err := clientset.CoreV1().Pods(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		log.Warnf("Failed to get pod '%s.%s', events won't be recorded on the pod: %v", namespace, name, err)
+		return nil
+	}
+
+	return &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  pod.Namespace,
+		Name:       pod.Name,
+		UID:        pod.UID,
+	}
+}
+
+// synced records successful sync of the commit into obj.
+func (r *eventRecorder) synced(obj runtime.Object, commitID string, diff keyDiff) {
+	if r == nil {
+		return
+	}
+	r.recorder.Eventf(obj, corev1.EventTypeNormal, reasonSynced, "Synced commit %s: %s", commitID, diff)
+}
+
+// failed records failed sync of the commit into obj.
+func (r *eventRecorder) failed(obj runtime.Object, commitID string, err error) {
+	if r == nil {
+		return
+	}
+	r.recorder.Eventf(obj, corev1.EventTypeWarning, reasonSyncFailed, "Failed to sync commit %s: %v", commitID, err)
+}
+
+// result records result of the whole sync into target on the watcher pod, successful syncs are recorded
+// only if they changed any object so that every watch interval doesn't produce an event.
+func (r *eventRecorder) result(kind string, target string, commitID string, changed bool, err error) {
+	if r == nil || r.pod == nil || (err == nil && !changed) {
+		return
+	}
+	if err != nil {
+		r.recorder.Eventf(r.pod, corev1.EventTypeWarning, reasonSyncFailed, "Failed to sync commit %s into %s '%s': %v", commitID, kind, target, err)
+		return
+	}
+	r.recorder.Eventf(r.pod, corev1.EventTypeNormal, reasonSynced, "Synced commit %s into %s '%s'", commitID, kind, target)
+}
+
+// keyDiff summary of changed data keys.
+type keyDiff struct {
+	added   int
+	updated int
+	removed int
+}
+
+func (d keyDiff) empty() bool {
+	return d.added == 0 && d.updated == 0 && d.removed == 0
+}
+
+func (d keyDiff) String() string {
+	return fmt.Sprintf("%d added, %d updated, %d removed", d.added, d.updated, d.removed)
+}
+
+// diffKeys compares data keys before and after the sync.
+func diffKeys[V any](before map[string]V, after map[string]V, equal func(V, V) bool) keyDiff {
+	var diff keyDiff
+	for k, v := range after {
+		old, ok := before[k]
+		switch {
+		case !ok:
+			diff.added++
+		case !equal(old, v):
+			diff.updated++
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			diff.removed++
+		}
+	}
+	return diff
+}
@@ -0,0 +1,127 @@
+package upload
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	testing2 "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestDiffKeys(t *testing.T) {
+	cases := []struct {
+		name     string
+		before   map[string]string
+		after    map[string]string
+		expected keyDiff
+	}{
+		{
+			name:     "Created",
+			after:    map[string]string{"a": "1", "b": "2"},
+			expected: keyDiff{added: 2},
+		},
+		{
+			name:     "Changed",
+			before:   map[string]string{"a": "1", "b": "2", "c": "3"},
+			after:    map[string]string{"a": "1", "b": "3", "d": "4"},
+			expected: keyDiff{added: 1, updated: 1, removed: 1},
+		},
+	}
+
+	for _, c := range cases {
+		diff := diffKeys(c.before, c.after, func(a, b string) bool { return a == b })
+		if diff != c.expected {
+			t.Errorf("%s case failed: expected '%s' but got '%s' instead", c.name, c.expected, diff)
+		}
+	}
+}
+
+func TestConfigmapUploader_UploadEvents(t *testing.T) {
+	cases := []struct {
+		name     string
+		existing []runtime.Object
+		fail     bool
+		expected []string
+	}{
+		{
+			name: "Created",
+			expected: []string{
+				"Normal Synced Synced commit 0123456789abcdef0123456789abcdef01234567: 0 added, 0 updated, 0 removed",
+				"Normal Synced Synced commit 0123456789abcdef0123456789abcdef01234567 into ConfigMap 'git2kube'",
+			},
+		},
+		{
+			name: "Patched",
+			existing: []runtime.Object{
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "git2kube", Namespace: "default"}, Data: map[string]string{"removed": "x"}},
+			},
+			expected: []string{
+				"Normal Synced Synced commit 0123456789abcdef0123456789abcdef01234567: 0 added, 0 updated, 1 removed",
+				"Normal Synced Synced commit 0123456789abcdef0123456789abcdef01234567 into ConfigMap 'git2kube'",
+			},
+		},
+		{
+			name: "Unchanged",
+			existing: []runtime.Object{
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+					Name:        "git2kube",
+					Namespace:   "default",
+					Annotations: map[string]string{refAnnotation: testCommit.Hash.String(), checksumAnnotation: checksum(map[string]string{})},
+				}},
+			},
+		},
+		{
+			name: "Failed",
+			existing: []runtime.Object{
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "git2kube", Namespace: "default"}},
+			},
+			fail: true,
+			expected: []string{
+				"Warning SyncFailed Failed to sync commit 0123456789abcdef0123456789abcdef01234567: failed to patch ConfigMap 'default.git2kube' (Forbidden): configmaps \"git2kube\" is forbidden: denied",
+				"Warning SyncFailed Failed to sync commit 0123456789abcdef0123456789abcdef01234567 into ConfigMap 'git2kube': failed to patch ConfigMap 'default.git2kube' (Forbidden): configmaps \"git2kube\" is forbidden: denied",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		fakeclient := testclient.NewSimpleClientset(c.existing...)
+		if c.fail {
+			fakeclient.PrependReactor("patch", "configmaps", func(action testing2.Action) (bool, runtime.Object, error) {
+				return true, nil, k8serrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "git2kube", errors.New("denied"))
+			})
+		}
+		recorder := record.NewFakeRecorder(10)
+		cu := &configmapUploader{
+			clientset:   fakeclient,
+			namespace:   "default",
+			name:        "git2kube",
+			labels:      map[string]string{},
+			annotations: map[string]string{},
+			mergeType:   Delete,
+			events: &eventRecorder{
+				recorder: recorder,
+				pod:      &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "git2kube"},
+			},
+		}
+		err := cu.Upload(testCommit, &mockFileIter{})
+		if c.fail != (err != nil) {
+			t.Errorf("%s case failed: unexpected result %v", c.name, err)
+		}
+
+		close(recorder.Events)
+		var events []string
+		for event := range recorder.Events {
+			events = append(events, event)
+		}
+		if !reflect.DeepEqual(events, c.expected) {
+			t.Errorf("%s case failed: expected events %q but got %q instead", c.name, c.expected, events)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package upload
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	ownerLabel = "git2kube.github.com/owner"
+
+	defaultNameTemplate = "{{.Name}}-{{.Dir}}"
+)
+
+// fanout splits files into multiple targets named after the directory at the configured depth.
+type fanout struct {
+	depth int
+	base  string
+	name  *template.Template
+}
+
+// fanoutResolver resolves target names during a single sync so that names of moved or removed directories
+// are released for the next one.
+type fanoutResolver struct {
+	fanout *fanout
+	// names rendered names indexed by directory path
+	names map[string]string
+	// dirs directory paths indexed by rendered names
+	dirs map[string]string
+}
+
+// fanoutData data available to the name template.
+type fanoutData struct {
+	// Name of the uploader target
+	Name string
+	// Dir name of the directory at configured depth
+	Dir string
+	// Path of the directory at configured depth
+	Path string
+}
+
+// newFanout creates fanout of targets derived from directories at depth, nil is returned if depth is 0.
+func newFanout(depth int, nameTemplate string, base string) (*fanout, error) {
+	if depth < 0 {
+		return nil, fmt.Errorf("split depth can't be negative, got %d", depth)
+	}
+	if depth == 0 {
+		return nil, nil
+	}
+
+	if errs := validation.IsValidLabelValue(base); len(errs) > 0 {
+		return nil, fmt.Errorf("name '%s' can't be used as owner label value: %s", base, strings.Join(errs, ", "))
+	}
+
+	if nameTemplate == "" {
+		nameTemplate = defaultNameTemplate
+	}
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse name template '%s': %w", nameTemplate, err)
+	}
+	log.Infof("Splitting targets by directories at depth %d named '%s'", depth, nameTemplate)
+
+	return &fanout{
+		depth: depth,
+		base:  base,
+		name:  tmpl,
+	}, nil
+}
+
+// resolver returns resolver of target names for a single sync, nil is returned if fanout is disabled.
+func (f *fanout) resolver() *fanoutResolver {
+	if f == nil {
+		return nil
+	}
+	return &fanoutResolver{
+		fanout: f,
+		names:  make(map[string]string),
+		dirs:   make(map[string]string),
+	}
+}
+
+// target returns name of the target for file along with the file path relative to the target directory.
+// Files outside of directories at configured depth are skipped.
+func (r *fanoutResolver) target(defaultName string, file string) (string, string, bool, error) {
+	if r == nil {
+		return defaultName, file, true, nil
+	}
+	f := r.fanout
+
+	parts := strings.Split(file, "/")
+	if len(parts) <= f.depth {
+		log.Debugf("Skipping '%s', not inside directory at depth %d", file, f.depth)
+		return "", "", false, nil
+	}
+
+	dir := strings.Join(parts[:f.depth], "/")
+	name, ok := r.names[dir]
+	if !ok {
+		var buf bytes.Buffer
+		err := f.name.Execute(&buf, fanoutData{Name: f.base, Dir: parts[f.depth-1], Path: dir})
+		if err != nil {
+			return "", "", false, fmt.Errorf("failed to render name for directory '%s': %w", dir, err)
+		}
+		name = buf.String()
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return "", "", false, fmt.Errorf("invalid name '%s' for directory '%s': %s", name, dir, strings.Join(errs, ", "))
+		}
+		if other, exists := r.dirs[name]; exists {
+			return "", "", false, fmt.Errorf("directories '%s' and '%s' resolve to the same name '%s'", other, dir, name)
+		}
+		r.names[dir] = name
+		r.dirs[name] = dir
+	}
+
+	return name, strings.Join(parts[f.depth:], "/"), true, nil
+}
+
+// ownerValue returns value of the owner label identifying targets of the instance syncing name from namespace,
+// instances syncing the same name from different namespaces must not prune copies of each other.
+func ownerValue(namespace, name string) (string, error) {
+	owner := namespace + "." + name
+	if errs := validation.IsValidLabelValue(owner); len(errs) > 0 {
+		return "", fmt.Errorf("namespace '%s' and name '%s' can't be used as owner label value: %s", namespace, name, strings.Join(errs, ", "))
+	}
+	return owner, nil
+}
+
+// ownerSelector returns label selector matching all objects labelled with the owner label value.
+func ownerSelector(owner string) string {
+	return fmt.Sprintf("%s=%s", ownerLabel, owner)
+}
+
+func sortedTargets[T any](targets map[string]T) []string {
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
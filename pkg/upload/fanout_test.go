@@ -0,0 +1,161 @@
+package upload
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFanout_Target(t *testing.T) {
+	cases := []struct {
+		name     string
+		depth    int
+		template string
+		file     string
+		target   string
+		path     string
+		skipped  bool
+		fail     bool
+	}{
+		{name: "Top level", depth: 1, file: "app/config.yaml", target: "git2kube-app", path: "config.yaml"},
+		{name: "Nested file", depth: 1, file: "app/conf/config.yaml", target: "git2kube-app", path: "conf/config.yaml"},
+		{name: "Second level", depth: 2, file: "apps/app/config.yaml", target: "git2kube-app", path: "config.yaml"},
+		{name: "Outside directory", depth: 1, file: "config.yaml", skipped: true},
+		{name: "Custom template", depth: 2, template: "{{.Dir}}", file: "apps/app/config.yaml", target: "app", path: "config.yaml"},
+		{name: "Path template", depth: 2, template: "{{.Path}}", file: "apps/app/config.yaml", fail: true},
+		{name: "Invalid name", depth: 1, file: "App_1/config.yaml", fail: true},
+	}
+
+	for _, c := range cases {
+		f, err := newFanout(c.depth, c.template, "git2kube")
+		if err != nil {
+			t.Fatalf("%s case failed: %v", c.name, err)
+		}
+
+		target, path, ok, err := f.resolver().target("git2kube", c.file)
+		if c.fail != (err != nil) {
+			t.Errorf("%s case failed: unexpected result %v", c.name, err)
+			continue
+		}
+		if c.fail {
+			continue
+		}
+		if ok == c.skipped || target != c.target || path != c.path {
+			t.Errorf("%s case failed: expected '%s' '%s' but got '%s' '%s' instead", c.name, c.target, c.path, target, path)
+		}
+	}
+}
+
+func TestFanout_TargetCollision(t *testing.T) {
+	f, _ := newFanout(2, "{{.Dir}}", "git2kube")
+	r := f.resolver()
+	if _, _, _, err := r.target("git2kube", "a/app/config.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := r.target("git2kube", "b/app/config.yaml"); err == nil {
+		t.Errorf("directories resolving to the same name should have failed")
+	}
+}
+
+func TestNewFanout(t *testing.T) {
+	if f, err := newFanout(0, "", "git2kube"); f != nil || err != nil {
+		t.Errorf("zero depth should disable fanout")
+	}
+	if _, err := newFanout(-1, "", "git2kube"); err == nil {
+		t.Errorf("negative depth should have failed")
+	}
+	if _, err := newFanout(1, "{{.Dir", "git2kube"); err == nil {
+		t.Errorf("invalid template should have failed")
+	}
+}
+
+func TestOwnerValue(t *testing.T) {
+	if owner, err := ownerValue("default", "git2kube"); owner != "default.git2kube" || err != nil {
+		t.Errorf("expected owner 'default.git2kube' but got '%s' (%v) instead", owner, err)
+	}
+	if _, err := ownerValue("default", strings.Repeat("a", 60)); err == nil {
+		t.Errorf("too long owner should have failed")
+	}
+}
+
+func TestConfigmapUploader_UploadFanout(t *testing.T) {
+	stale := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "git2kube-removed", Namespace: "default", Labels: map[string]string{ownerLabel: "git2kube"}}}
+	foreign := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "foreign", Namespace: "default"}}
+	fakeclient := testclient.NewSimpleClientset(stale, foreign)
+
+	f, _ := newFanout(1, "", "git2kube")
+	cu := &configmapUploader{
+		clientset:   fakeclient,
+		namespace:   "default",
+		name:        "git2kube",
+		labels:      map[string]string{ownerLabel: "git2kube"},
+		annotations: map[string]string{},
+		includes:    []*regexp.Regexp{regexp.MustCompile(".*")},
+		mergeType:   Delete,
+		fanout:      f,
+	}
+
+	a, _ := newMemoryFile("a/config.yaml", filemode.Regular, []byte("a"))
+	b, _ := newMemoryFile("b/conf/config.yaml", filemode.Regular, []byte("b"))
+	root, _ := newMemoryFile("config.yaml", filemode.Regular, []byte("root"))
+	if err := cu.Upload(testCommit, &fileIter{files: []*object.File{a, b, root}}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := fakeclient.CoreV1().ConfigMaps("default").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make(map[string]map[string]string)
+	for _, cm := range list.Items {
+		data[cm.Name] = cm.Data
+	}
+	expected := map[string]map[string]string{
+		"foreign":    nil,
+		"git2kube-a": {"config.yaml": "a"},
+		"git2kube-b": {"conf.config.yaml": "b"},
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected ConfigMaps %v but got %v instead", expected, data)
+	}
+}
+
+func TestConfigmapUploader_UploadFanoutMovedDirectory(t *testing.T) {
+	fakeclient := testclient.NewSimpleClientset()
+	f, _ := newFanout(2, "", "cfg")
+	cu := &configmapUploader{
+		clientset:   fakeclient,
+		namespace:   "default",
+		name:        "cfg",
+		labels:      map[string]string{ownerLabel: "cfg"},
+		annotations: map[string]string{},
+		includes:    []*regexp.Regexp{regexp.MustCompile(".*")},
+		mergeType:   Delete,
+		fanout:      f,
+	}
+
+	before, _ := newMemoryFile("x/app/config.yaml", filemode.Regular, []byte("a"))
+	if err := cu.Upload(testCommit, &fileIter{files: []*object.File{before}}); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := newMemoryFile("y/app/config.yaml", filemode.Regular, []byte("b"))
+	if err := cu.Upload(testCommit, &fileIter{files: []*object.File{after}}); err != nil {
+		t.Fatalf("moved directory should have been synced: %v", err)
+	}
+
+	res, err := fakeclient.CoreV1().ConfigMaps("default").Get(context.TODO(), "cfg-app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Data["config.yaml"] != "b" {
+		t.Errorf("expected moved directory content but got %v instead", res.Data)
+	}
+}
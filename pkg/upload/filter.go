@@ -0,0 +1,180 @@
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+)
+
+// FilterSyntax syntax of the include and exclude rules.
+type FilterSyntax string
+
+const (
+	// RegexFilterSyntax rules are regular expressions matched against the file path.
+	RegexFilterSyntax FilterSyntax = "regex"
+	// GlobFilterSyntax rules are gitignore-style globs, '**' matches any number of directories.
+	GlobFilterSyntax FilterSyntax = "glob"
+)
+
+// DefaultIgnoreFile name of the file in the repository with gitignore-style rules of files that are not synced.
+const DefaultIgnoreFile = ".git2kubeignore"
+
+// compileFilters compiles include or exclude rules of the syntax into regular expressions.
+func compileFilters(syntax FilterSyntax, rules []string) ([]*regexp.Regexp, error) {
+	switch syntax {
+	case "", RegexFilterSyntax:
+		return stringsToRegExp(rules)
+	case GlobFilterSyntax:
+		result := make([]*regexp.Regexp, len(rules))
+		for i, rule := range rules {
+			regex, err := globToRegexp(rule)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = regex
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("invalid filter syntax '%s' (options: regex|glob)", syntax)
+	}
+}
+
+// globToRegexp converts gitignore-style glob into regular expression matching file paths. Glob without '/'
+// matches name at any depth, otherwise it is relative to the repository root. Glob matching a directory
+// matches all files in it, trailing '/' matches only directories.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	pattern := glob
+	dirOnly := strings.HasSuffix(pattern, "/") && !strings.HasSuffix(pattern, "\\/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if pattern == "" {
+		return nil, fmt.Errorf("invalid glob '%s'", glob)
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	if strings.Contains(pattern, "/") {
+		pattern = strings.TrimPrefix(pattern, "/")
+	} else {
+		b.WriteString("(?:.*/)?")
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' && (i == 0 || pattern[i-1] == '/') {
+				switch {
+				case i+2 == len(pattern):
+					b.WriteString(".*")
+					i++
+					continue
+				case pattern[i+2] == '/':
+					b.WriteString("(?:.*/)?")
+					i += 2
+					continue
+				}
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid glob '%s': missing ']'", glob)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	if dirOnly {
+		b.WriteString("/.*$")
+	} else {
+		b.WriteString("(?:/.*)?$")
+	}
+
+	regex, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob '%s': %w", glob, err)
+	}
+	return regex, nil
+}
+
+type ignoreRule struct {
+	regex  *regexp.Regexp
+	negate bool
+}
+
+// ignoreRules rules of the ignore file, the last matching rule wins and rules starting with '!' include
+// the file again. Unlike git, files can be included again even if their directory is ignored.
+type ignoreRules []ignoreRule
+
+// readIgnoreRules reads rules from the ignore file in source, no rules are returned if name is empty
+// or the file does not exist.
+func readIgnoreRules(name string, source fileSource) (ignoreRules, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	content, err := source(name)
+	if errors.Is(err, object.ErrFileNotFound) || errors.Is(err, fs.ErrNotExist) {
+		log.Debugf("Ignore file '%s' not found", name)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ignore file '%s': %w", name, err)
+	}
+
+	rules, err := parseIgnoreRules(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ignore file '%s': %w", name, err)
+	}
+	log.Debugf("Loaded %d rules from ignore file '%s'", len(rules), name)
+	return rules, nil
+}
+
+// parseIgnoreRules parses gitignore-style rules, blank lines and comments starting with '#' are skipped.
+func parseIgnoreRules(content string) (ignoreRules, error) {
+	var rules ignoreRules
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		negate := strings.HasPrefix(line, "!")
+		if negate {
+			line = line[1:]
+		}
+		regex, err := globToRegexp(line)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, ignoreRule{regex: regex, negate: negate})
+	}
+	return rules, nil
+}
+
+func (r ignoreRules) ignored(name string) bool {
+	for i := len(r) - 1; i >= 0; i-- {
+		if r[i].regex.MatchString(name) {
+			return !r[i].negate
+		}
+	}
+	return false
+}
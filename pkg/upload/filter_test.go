@@ -0,0 +1,188 @@
+package upload
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	cases := []struct {
+		glob     string
+		matches  []string
+		excludes []string
+	}{
+		{
+			glob:     "*.yaml",
+			matches:  []string{"a.yaml", "apps/a.yaml", "apps/a/b.yaml"},
+			excludes: []string{"a.yml", "a.yaml.bak"},
+		},
+		{
+			glob:     "/*.yaml",
+			matches:  []string{"a.yaml"},
+			excludes: []string{"apps/a.yaml"},
+		},
+		{
+			glob:     "apps/*.yaml",
+			matches:  []string{"apps/a.yaml"},
+			excludes: []string{"apps/a/b.yaml", "other/apps/a.yaml"},
+		},
+		{
+			glob:     "apps/**/*.yaml",
+			matches:  []string{"apps/a.yaml", "apps/a/b.yaml", "apps/a/b/c.yaml"},
+			excludes: []string{"other/apps/a.yaml", "apps/a.json"},
+		},
+		{
+			glob:     "**/config",
+			matches:  []string{"config", "a/config", "a/b/config/file"},
+			excludes: []string{"a/configs"},
+		},
+		{
+			glob:     "apps/**",
+			matches:  []string{"apps/a", "apps/a/b"},
+			excludes: []string{"apps", "other/apps/a"},
+		},
+		{
+			glob:    "**",
+			matches: []string{"a", "a/b"},
+		},
+		{
+			glob:     "docs/",
+			matches:  []string{"docs/a.md", "apps/docs/a.md"},
+			excludes: []string{"docs"},
+		},
+		{
+			glob:     "docs",
+			matches:  []string{"docs", "docs/a.md", "apps/docs"},
+			excludes: []string{"docs.md"},
+		},
+		{
+			glob:     "a?.[!b]*",
+			matches:  []string{"a1.c", "x/ab.cd"},
+			excludes: []string{"a.c", "a1.b", "a/1.c"},
+		},
+		{
+			glob:     "\\#*",
+			matches:  []string{"#a"},
+			excludes: []string{"a#"},
+		},
+		{
+			glob:     "/.*",
+			matches:  []string{".gitignore", ".github/ci.yaml"},
+			excludes: []string{"apps/.hidden"},
+		},
+	}
+
+	for _, c := range cases {
+		regex, err := globToRegexp(c.glob)
+		if err != nil {
+			t.Fatalf("%s case failed: %v", c.glob, err)
+		}
+		for _, name := range c.matches {
+			if !regex.MatchString(name) {
+				t.Errorf("%s case failed: expected '%s' to match (%s)", c.glob, name, regex)
+			}
+		}
+		for _, name := range c.excludes {
+			if regex.MatchString(name) {
+				t.Errorf("%s case failed: expected '%s' not to match (%s)", c.glob, name, regex)
+			}
+		}
+	}
+}
+
+func TestCompileFilters(t *testing.T) {
+	for _, c := range []struct {
+		syntax FilterSyntax
+		rule   string
+	}{
+		{syntax: RegexFilterSyntax, rule: "["},
+		{syntax: GlobFilterSyntax, rule: "[a"},
+		{syntax: GlobFilterSyntax, rule: "/"},
+		{syntax: "unknown", rule: ".*"},
+	} {
+		if _, err := compileFilters(c.syntax, []string{c.rule}); err == nil {
+			t.Errorf("expected error for %s rule '%s'", c.syntax, c.rule)
+		}
+	}
+}
+
+func TestIgnoreRules_Ignored(t *testing.T) {
+	rules, err := parseIgnoreRules("# generated files\n\n*.gen.yaml\n!keep.gen.yaml\ndocs/\n\\!important \n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ignored := map[string]bool{
+		"a.yaml":            false,
+		"a.gen.yaml":        true,
+		"apps/b.gen.yaml":   true,
+		"keep.gen.yaml":     false,
+		"docs/readme.md":    true,
+		"!important":        true,
+		"# generated files": false,
+	}
+	for name, expected := range ignored {
+		if rules.ignored(name) != expected {
+			t.Errorf("expected '%s' ignored to be %t", name, expected)
+		}
+	}
+}
+
+func TestConfigmapUploader_UploadIgnoreFile(t *testing.T) {
+	commit := commitOf(t, map[string]string{
+		".git2kubeignore":  "*.md\n",
+		"config.yaml":      "a: 1\n",
+		"docs/readme.md":   "docs",
+		"scripts/setup.sh": "true",
+	})
+	iter, err := commit.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fakeclient := testclient.NewSimpleClientset()
+	cu := &configmapUploader{
+		clientset:   fakeclient,
+		namespace:   "default",
+		name:        "git2kube",
+		labels:      map[string]string{},
+		annotations: map[string]string{},
+		includes:    []*regexp.Regexp{regexp.MustCompile(".*")},
+		excludes:    []*regexp.Regexp{regexp.MustCompile(`^\..*`)},
+		ignoreFile:  DefaultIgnoreFile,
+		mergeType:   Delete,
+	}
+	if err := cu.Upload(commit, iter); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := fakeclient.CoreV1().ConfigMaps("default").Get(context.TODO(), "git2kube", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"config.yaml": "a: 1\n", "scripts.setup.sh": "true"}
+	if !reflect.DeepEqual(res.Data, expected) {
+		t.Errorf("expected data %v but got %v instead", expected, res.Data)
+	}
+}
+
+func TestFolderUploader_InvalidIgnoreFile(t *testing.T) {
+	commit := commitOf(t, map[string]string{
+		".git2kubeignore": "[a\n",
+		"config.yaml":     "a: 1\n",
+	})
+
+	fu := &folderUploader{
+		includes:   []*regexp.Regexp{regexp.MustCompile(".*")},
+		ignoreFile: DefaultIgnoreFile,
+	}
+	if _, err := fu.collect(commit, &fileIter{files: []*object.File{}}); err == nil {
+		t.Error("expected invalid ignore file to fail the sync")
+	}
+}
@@ -0,0 +1,786 @@
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// currentLink name of the symlink pointing to the active revision in atomic mode.
+	currentLink = "current"
+	// revisionsDir folder holding revisions in atomic mode.
+	revisionsDir = ".revisions"
+
+	defaultFileMode os.FileMode = 0o644
+	defaultDirMode  os.FileMode = 0o755
+
+	// maxSymlinkHops limit of symlinks followed when resolving a path, same as the Linux kernel.
+	maxSymlinkHops = 40
+)
+
+type folderUploader struct {
+	name         string
+	includes     []*regexp.Regexp
+	excludes     []*regexp.Regexp
+	ignoreFile   string
+	transformers []transformer
+	atomic       bool
+	revisions    int
+	fileMode     os.FileMode
+	dirMode      os.FileMode
+	owner        *owner
+	hook         *hook
+	// pending files changed by syncs whose hook has not succeeded yet.
+	pending []string
+}
+
+// folderChanges paths of files changed in target folder.
+type folderChanges struct {
+	added    []string
+	modified []string
+	deleted  []string
+}
+
+func (c folderChanges) empty() bool {
+	return len(c.added) == 0 && len(c.modified) == 0 && len(c.deleted) == 0
+}
+
+// files returns sorted paths of all changed files.
+func (c folderChanges) files() []string {
+	files := make([]string, 0, len(c.added)+len(c.modified)+len(c.deleted))
+	files = append(files, c.added...)
+	files = append(files, c.modified...)
+	files = append(files, c.deleted...)
+	sort.Strings(files)
+	return files
+}
+
+func (c folderChanges) String() string {
+	return fmt.Sprintf("%d added, %d modified, %d deleted", len(c.added), len(c.modified), len(c.deleted))
+}
+
+// owner of the written files and folders.
+type owner struct {
+	uid int
+	gid int
+}
+
+func newFolderUploader(o UploaderOptions) (Uploader, error) {
+	err := checkTarget(o.Target, o.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.KeepExisting {
+		log.Infof("Keeping existing content of folder %s, it will be reconciled on first upload", o.Target)
+	} else {
+		err = os.RemoveAll(o.Target)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Removed content of folder %s", o.Target)
+	}
+	err = os.MkdirAll(o.Target, os.ModePerm) // #nosec G301
+	if err != nil {
+		return nil, err
+	}
+
+	includesRegex, err := compileFilters(o.FilterSyntax, o.Includes)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Loaded include rules %s", includesRegex)
+
+	excludesRegex, err := compileFilters(o.FilterSyntax, o.Excludes)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Loaded exclude rules %s", excludesRegex)
+
+	identities, err := loadAgeIdentities(o.AgeKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ageDecryptRegex, err := stringsToRegExp(o.AgeDecrypt)
+	if err != nil {
+		return nil, err
+	}
+
+	envsubstRegex, err := stringsToRegExp(o.Envsubst)
+	if err != nil {
+		return nil, err
+	}
+
+	templatesRegex, err := stringsToRegExp(o.Templates)
+	if err != nil {
+		return nil, err
+	}
+
+	renderer, err := newTemplateRenderer(templatesRegex, o.TemplateValues, o.TemplateEnvAllow)
+	if err != nil {
+		return nil, err
+	}
+
+	validateRegex, err := stringsToRegExp(o.Validate)
+	if err != nil {
+		return nil, err
+	}
+
+	validator, err := newValidator(validateRegex, o.ValidateSchemas)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Revisions < 0 {
+		return nil, fmt.Errorf("number of kept revisions can't be negative, got %d", o.Revisions)
+	}
+
+	fileMode, err := parseFileMode(o.FileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	dirMode, err := parseFileMode(o.DirMode)
+	if err != nil {
+		return nil, err
+	}
+
+	fileOwner, err := parseOwner(o.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	return &folderUploader{
+		includes:   includesRegex,
+		excludes:   excludesRegex,
+		ignoreFile: o.IgnoreFile,
+		transformers: []transformer{
+			newAgeDecrypter(ageDecryptRegex, identities),
+			newEnvSubstituter(envsubstRegex, o.EnvsubstAllow),
+			renderer,
+			validator,
+		},
+		name:      o.Target,
+		atomic:    o.Atomic,
+		revisions: o.Revisions,
+		fileMode:  fileMode,
+		dirMode:   dirMode,
+		owner:     fileOwner,
+		hook:      newHook(o.HookCommand, o.HookURL, o.HookTimeout),
+	}, nil
+}
+
+func (u *folderUploader) Upload(commit *object.Commit, iter FileIter) error {
+	files, err := u.collect(commit, iter)
+	if err != nil {
+		return err
+	}
+
+	var changes folderChanges
+	if u.atomic {
+		changes, err = u.uploadRevision(commit, files)
+	} else {
+		changes, err = u.sync(u.name, files)
+	}
+	if err != nil {
+		return err
+	}
+
+	if changes.empty() {
+		log.Infof("Folder '%s' is up to date", u.name)
+	} else {
+		log.Infof("Updated folder '%s': %s", u.name, changes)
+	}
+
+	return u.runHook(commit, changes)
+}
+
+// runHook runs the post-sync hook if there are any changes, changes of failed runs are retried with the next sync.
+func (u *folderUploader) runHook(commit *object.Commit, changes folderChanges) error {
+	if u.hook == nil {
+		return nil
+	}
+
+	u.pending = mergeSorted(u.pending, changes.files())
+	if len(u.pending) == 0 {
+		return nil
+	}
+
+	if err := u.hook.run(commit, u.name, u.pending); err != nil {
+		return err
+	}
+	u.pending = nil
+	return nil
+}
+
+// collect returns files that should be written into target indexed by their path.
+func (u *folderUploader) collect(commit *object.Commit, iter FileIter) (map[string]*object.File, error) {
+	ignore, err := readIgnoreRules(u.ignoreFile, commitFiles(commit))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*object.File)
+	err = iter.ForEach(func(file *object.File) error {
+		if filterFile(file, u.includes, u.excludes, ignore) {
+			file, err := transformFile(commit, file, u.transformers)
+			if err != nil {
+				return err
+			}
+			if err := checkFilePath(file); err != nil {
+				log.Warnf("Security warning, skipping file: %v", err)
+				return nil
+			}
+			files[file.Name] = file
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := symlinkTargets(files)
+	if err != nil {
+		return nil, err
+	}
+	for name, err := range checkSymlinks(links) {
+		log.Warnf("Security warning, skipping file: %v", err)
+		delete(files, name)
+	}
+
+	return files, nil
+}
+
+// checkFilePath verifies that the file and target of the symlink stay within the target folder.
+func checkFilePath(file *object.File) error {
+	if !isLocalPath(file.Name) {
+		return fmt.Errorf("path '%s' escapes target folder", file.Name)
+	}
+
+	if file.Mode == filemode.Symlink {
+		target, err := file.Contents()
+		if err != nil {
+			return err
+		}
+		if path.IsAbs(target) || !isLocalPath(path.Join(path.Dir(file.Name), target)) {
+			return fmt.Errorf("symlink '%s' points to '%s' outside of target folder", file.Name, target)
+		}
+	}
+
+	return nil
+}
+
+// symlinkTargets returns targets of the symlinks in files indexed by their path.
+func symlinkTargets(files map[string]*object.File) (map[string]string, error) {
+	links := make(map[string]string)
+	for name, file := range files {
+		if file.Mode != filemode.Symlink {
+			continue
+		}
+		target, err := file.Contents()
+		if err != nil {
+			return nil, err
+		}
+		links[name] = target
+	}
+	return links, nil
+}
+
+// checkSymlinks verifies that targets of the symlinks resolved through the other symlinks stay within the target
+// folder, checking each symlink on its own is not enough as a chain of local symlinks can step out of it.
+// Errors are returned indexed by the symlink path.
+func checkSymlinks(links map[string]string) map[string]error {
+	errs := make(map[string]error)
+	for name, target := range links {
+		if err := resolveLocalPath(links, name); err != nil {
+			errs[name] = fmt.Errorf("symlink '%s' points to '%s' outside of target folder: %w", name, target, err)
+		}
+	}
+	return errs
+}
+
+// resolveLocalPath resolves slash separated name component by component following the symlinks in links the way
+// the filesystem would, an error is returned if the resolved path steps out of the root.
+func resolveLocalPath(links map[string]string, name string) error {
+	var resolved []string
+	pending := strings.Split(name, "/")
+	for hops := 0; len(pending) > 0; {
+		part := pending[0]
+		pending = pending[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return errors.New("path steps out of the root")
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+
+		resolved = append(resolved, part)
+		target, ok := links[strings.Join(resolved, "/")]
+		if !ok {
+			continue
+		}
+		if hops++; hops > maxSymlinkHops {
+			return errors.New("too many levels of symlinks")
+		}
+		if path.IsAbs(target) {
+			return errors.New("absolute symlink target")
+		}
+		resolved = resolved[:len(resolved)-1]
+		pending = append(strings.Split(target, "/"), pending...)
+	}
+	return nil
+}
+
+// isLocalPath returns true if slash separated name is relative and does not step out of its root.
+func isLocalPath(name string) bool {
+	if strings.ContainsRune(name, 0) {
+		return false
+	}
+	return filepath.IsLocal(filepath.FromSlash(name))
+}
+
+// uploadRevision writes files into new revision folder and atomically switches the current symlink to it.
+// No revision is created if files are identical with the current one.
+func (u *folderUploader) uploadRevision(commit *object.Commit, files map[string]*object.File) (folderChanges, error) {
+	link := filepath.Join(u.name, currentLink)
+	current, err := filepath.EvalSymlinks(link)
+	if err != nil && !os.IsNotExist(err) {
+		return folderChanges{}, err
+	}
+
+	changes, err := u.diff(current, files)
+	if err != nil || changes.empty() {
+		return changes, err
+	}
+
+	revision := fmt.Sprintf("%d-%s", time.Now().UnixNano(), commit.Hash)
+	dir := filepath.Join(u.name, revisionsDir, revision)
+	if err := u.mkdirAll(dir); err != nil {
+		return folderChanges{}, err
+	}
+
+	for _, name := range sortedKeys(files) {
+		if err := u.write(dir, files[name]); err != nil {
+			if rerr := os.RemoveAll(dir); rerr != nil {
+				log.Warnf("Unable to remove incomplete revision '%s': %v", dir, rerr)
+			}
+			return folderChanges{}, err
+		}
+	}
+
+	// Relative target keeps the link valid when the folder is mounted elsewhere (e.g. in sidecar consumer)
+	tmpLink := link + ".tmp"
+	if err := os.Remove(tmpLink); err != nil && !os.IsNotExist(err) {
+		return folderChanges{}, err
+	}
+	if err := os.Symlink(filepath.Join(revisionsDir, revision), tmpLink); err != nil {
+		return folderChanges{}, err
+	}
+	if err := os.Rename(tmpLink, link); err != nil {
+		return folderChanges{}, err
+	}
+	log.Infof("Switched '%s' to revision '%s'", link, revision)
+
+	return changes, u.pruneRevisions()
+}
+
+// pruneRevisions removes all but the current and configured number of previous revisions.
+func (u *folderUploader) pruneRevisions() error {
+	dir := filepath.Join(u.name, revisionsDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	// Entries are sorted by name which starts with the creation timestamp
+	for i := 0; i < len(entries)-u.revisions-1; i++ {
+		log.Debugf("Removing old revision '%s'", entries[i].Name())
+		if err := os.RemoveAll(filepath.Join(dir, entries[i].Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sync writes changed files into root folder and removes files that are no longer present.
+func (u *folderUploader) sync(root string, files map[string]*object.File) (folderChanges, error) {
+	changes, err := u.diff(root, files)
+	if err != nil {
+		return folderChanges{}, err
+	}
+
+	// Deleted files go first so that no stale symlink can redirect the writes
+	for _, name := range changes.deleted {
+		log.Debugf("Removing '%s'", name)
+		if err := os.Remove(filepath.Join(root, name)); err != nil {
+			return folderChanges{}, err
+		}
+	}
+	for _, name := range changes.added {
+		if err := u.write(root, files[name]); err != nil {
+			return folderChanges{}, err
+		}
+	}
+	for _, name := range changes.modified {
+		if err := u.write(root, files[name]); err != nil {
+			return folderChanges{}, err
+		}
+	}
+
+	return changes, nil
+}
+
+// diff compares files with the content of root folder, missing root is treated as empty folder.
+func (u *folderUploader) diff(root string, files map[string]*object.File) (folderChanges, error) {
+	var changes folderChanges
+	if root != "" {
+		err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && p == root {
+					return nil
+				}
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			name, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			if _, exists := files[filepath.ToSlash(name)]; !exists {
+				changes.deleted = append(changes.deleted, filepath.ToSlash(name))
+			}
+			return nil
+		})
+		if err != nil {
+			return folderChanges{}, err
+		}
+	}
+
+	for _, name := range sortedKeys(files) {
+		if root == "" {
+			changes.added = append(changes.added, name)
+			continue
+		}
+
+		info, err := os.Lstat(filepath.Join(root, name))
+		if os.IsNotExist(err) {
+			changes.added = append(changes.added, name)
+			continue
+		}
+		if err != nil {
+			return folderChanges{}, err
+		}
+
+		modified, err := u.modified(filepath.Join(root, name), info, files[name])
+		if err != nil {
+			return folderChanges{}, err
+		}
+		if modified {
+			changes.modified = append(changes.modified, name)
+		}
+	}
+
+	return changes, nil
+}
+
+// modified returns true if file on disk with info differs from the file in repository.
+func (u *folderUploader) modified(dst string, info os.FileInfo, file *object.File) (bool, error) {
+	if file.Mode == filemode.Symlink {
+		if info.Mode()&os.ModeSymlink == 0 {
+			return true, nil
+		}
+		target, err := os.Readlink(dst)
+		if err != nil {
+			return false, err
+		}
+		content, err := file.Contents()
+		if err != nil {
+			return false, err
+		}
+		return target != content, nil
+	}
+
+	if !info.Mode().IsRegular() || info.Mode().Perm() != u.permissions(file.Mode) || info.Size() != file.Size {
+		return true, nil
+	}
+
+	content, err := os.ReadFile(dst) // #nosec G304
+	if err != nil {
+		return false, err
+	}
+	return plumbing.ComputeHash(plumbing.BlobObject, content) != file.Hash, nil
+}
+
+// write writes file into root folder creating missing parent folders.
+func (u *folderUploader) write(root string, file *object.File) error {
+	dst := filepath.Join(root, file.Name)
+	log.Debugf("Writing '%s'", dst)
+	if err := checkParents(root, file.Name); err != nil {
+		return err
+	}
+	if err := u.mkdirAll(filepath.Dir(dst)); err != nil {
+		return err
+	}
+
+	if file.Mode == filemode.Symlink {
+		return u.writeSymlink(file, dst)
+	}
+	return u.writeFile(file, dst)
+}
+
+// checkParents refuses to write through parent folders of name which are symlinks.
+func checkParents(root string, name string) error {
+	dir := root
+	parts := strings.Split(path.Dir(name), "/")
+	for _, part := range parts {
+		if part == "." {
+			continue
+		}
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to write '%s' through symlink '%s'", name, dir)
+		}
+	}
+	return nil
+}
+
+// writeFile writes content of the file into dst with mode derived from the git file mode.
+func (u *folderUploader) writeFile(file *object.File, dst string) error {
+	if info, err := os.Lstat(dst); err == nil && !info.Mode().IsRegular() {
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+	}
+
+	source, err := file.Reader()
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	mode := u.permissions(file.Mode)
+	destination, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode) // #nosec G304
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	if _, err := io.Copy(destination, source); err != nil {
+		return err
+	}
+
+	// Mode of an existing file is not changed by OpenFile
+	if err := destination.Chmod(mode); err != nil {
+		return err
+	}
+	return u.chown(dst)
+}
+
+// writeSymlink creates symlink at dst pointing to the target stored in the file content.
+func (u *folderUploader) writeSymlink(file *object.File, dst string) error {
+	target, err := file.Contents()
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	if err := os.Symlink(target, dst); err != nil {
+		return err
+	}
+	return u.chown(dst)
+}
+
+// mkdirAll creates dir along with missing parents using configured mode and owner.
+func (u *folderUploader) mkdirAll(dir string) error {
+	if _, err := os.Lstat(dir); err == nil {
+		return nil
+	}
+	if err := u.mkdirAll(filepath.Dir(dir)); err != nil {
+		return err
+	}
+
+	mode := u.dirMode
+	if mode == 0 {
+		mode = defaultDirMode
+	}
+
+	if err := os.Mkdir(dir, mode); err != nil && !os.IsExist(err) {
+		return err
+	}
+	// Mkdir is affected by umask
+	if err := os.Chmod(dir, mode); err != nil {
+		return err
+	}
+	return u.chown(dir)
+}
+
+// permissions returns permissions for file with git mode, executables get execute bit wherever read bit is set.
+func (u *folderUploader) permissions(mode filemode.FileMode) os.FileMode {
+	perm := u.fileMode
+	if perm == 0 {
+		perm = defaultFileMode
+	}
+	if mode == filemode.Executable {
+		perm |= (perm & 0o444) >> 2
+	}
+	return perm
+}
+
+func (u *folderUploader) chown(name string) error {
+	if u.owner == nil {
+		return nil
+	}
+	return os.Lchown(name, u.owner.uid, u.owner.gid)
+}
+
+// checkTarget refuses target folders whose content must never be replaced, i.e. root or folders overlapping with the cache.
+func checkTarget(target string, source string) error {
+	if target == "" {
+		return fmt.Errorf("target folder can't be empty")
+	}
+
+	targetPath, err := resolvePath(target)
+	if err != nil {
+		return err
+	}
+	if targetPath == string(filepath.Separator) {
+		return fmt.Errorf("refusing to use root '%s' as target folder", target)
+	}
+
+	if source == "" {
+		return nil
+	}
+	sourcePath, err := resolvePath(source)
+	if err != nil {
+		return err
+	}
+	if isWithin(targetPath, sourcePath) || isWithin(sourcePath, targetPath) {
+		return fmt.Errorf("target folder '%s' can't overlap with cache folder '%s'", target, source)
+	}
+
+	return nil
+}
+
+// resolvePath returns absolute path with symlinks resolved as far as the path exists.
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(append([]string{path}, missing...)...), nil
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
+// isWithin returns true if path is equal to or nested in root.
+func isWithin(path string, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// parseFileMode parses octal permissions, zero is returned for empty string.
+func parseFileMode(str string) (os.FileMode, error) {
+	if str == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(str, 8, 32)
+	if err != nil || mode == 0 || mode > uint64(os.ModePerm) {
+		return 0, fmt.Errorf("invalid mode '%s', octal permissions expected (e.g. 0644)", str)
+	}
+	return os.FileMode(mode), nil
+}
+
+// parseOwner parses owner in UID:GID format, nil is returned for empty string.
+func parseOwner(str string) (*owner, error) {
+	if str == "" {
+		return nil, nil
+	}
+	uidStr, gidStr, ok := strings.Cut(str, ":")
+	if !ok {
+		return nil, fmt.Errorf("owner '%s' does not contain required char ':'", str)
+	}
+	uid, err := strconv.Atoi(uidStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid owner uid '%s': %w", uidStr, err)
+	}
+	gid, err := strconv.Atoi(gidStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid owner gid '%s': %w", gidStr, err)
+	}
+	return &owner{uid: uid, gid: gid}, nil
+}
+
+// mergeSorted merges two sorted string slices dropping duplicates.
+func mergeSorted(a []string, b []string) []string {
+	merged := make([]string, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		var next string
+		switch {
+		case len(b) == 0 || (len(a) > 0 && a[0] < b[0]):
+			next, a = a[0], a[1:]
+		case len(a) == 0 || b[0] < a[0]:
+			next, b = b[0], b[1:]
+		default:
+			next, a, b = a[0], a[1:], b[1:]
+		}
+		merged = append(merged, next)
+	}
+	return merged
+}
+
+func sortedKeys(files map[string]*object.File) []string {
+	keys := make([]string, 0, len(files))
+	for k := range files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
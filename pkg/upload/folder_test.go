@@ -0,0 +1,409 @@
+package upload
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestFolderUploader_UploadAtomic(t *testing.T) {
+	target := t.TempDir()
+	cu := &folderUploader{
+		name:      target,
+		includes:  []*regexp.Regexp{regexp.MustCompile(".*")},
+		atomic:    true,
+		revisions: 1,
+	}
+
+	iters := []*mockFileIter{
+		{files: []*object.File{object.NewFile("test.json", filemode.Regular, &object.Blob{})}},
+		{files: []*object.File{object.NewFile("test.yaml", filemode.Regular, &object.Blob{})}},
+		{files: []*object.File{object.NewFile("test.json", filemode.Regular, &object.Blob{}), object.NewFile("test.yaml", filemode.Regular, &object.Blob{})}},
+	}
+
+	for i, iter := range iters {
+		if err := cu.Upload(testCommit, iter); err != nil {
+			t.Fatalf("upload %d failed: %v", i, err)
+		}
+
+		link, err := os.Readlink(filepath.Join(target, currentLink))
+		if err != nil {
+			t.Fatalf("upload %d failed: %v", i, err)
+		}
+		if filepath.IsAbs(link) {
+			t.Errorf("upload %d failed: expected relative link but got '%s'", i, link)
+		}
+
+		for _, f := range iter.files {
+			if _, err := os.Stat(filepath.Join(target, currentLink, f.Name)); err != nil {
+				t.Errorf("upload %d failed: %v", i, err)
+			}
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(target, currentLink, "test.json")); err != nil {
+		t.Errorf("expected test.json in current revision: %v", err)
+	}
+
+	revisions, err := os.ReadDir(filepath.Join(target, revisionsDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 {
+		t.Errorf("expected current and 1 previous revision but got %d revisions", len(revisions))
+	}
+}
+
+func TestFolderUploader_UploadModes(t *testing.T) {
+	script, _ := newMemoryFile("bin/run.sh", filemode.Executable, []byte("#!/bin/sh\n"))
+	config, _ := newMemoryFile("config.yaml", filemode.Regular, []byte("a: b\n"))
+	link, _ := newMemoryFile("link.yaml", filemode.Symlink, []byte("config.yaml"))
+
+	cases := []struct {
+		name       string
+		fileMode   os.FileMode
+		dirMode    os.FileMode
+		scriptMode os.FileMode
+		configMode os.FileMode
+		binMode    os.FileMode
+	}{
+		{
+			name:       "Default modes",
+			scriptMode: 0o755,
+			configMode: 0o644,
+			binMode:    0o755,
+		},
+		{
+			name:       "Fixed modes",
+			fileMode:   0o440,
+			dirMode:    0o750,
+			scriptMode: 0o550,
+			configMode: 0o440,
+			binMode:    0o750,
+		},
+	}
+
+	for _, c := range cases {
+		target := t.TempDir()
+		cu := &folderUploader{
+			name:     target,
+			includes: []*regexp.Regexp{regexp.MustCompile(".*")},
+			fileMode: c.fileMode,
+			dirMode:  c.dirMode,
+		}
+
+		if err := cu.Upload(testCommit, &fileIter{files: []*object.File{script, config, link}}); err != nil {
+			t.Errorf("%s case failed: %v", c.name, err)
+			continue
+		}
+
+		assertMode(t, c.name, filepath.Join(target, "bin/run.sh"), c.scriptMode)
+		assertMode(t, c.name, filepath.Join(target, "config.yaml"), c.configMode)
+		assertMode(t, c.name, filepath.Join(target, "bin"), c.binMode|os.ModeDir)
+
+		linkTarget, err := os.Readlink(filepath.Join(target, "link.yaml"))
+		if err != nil {
+			t.Errorf("%s case failed: %v", c.name, err)
+		} else if linkTarget != "config.yaml" {
+			t.Errorf("%s case failed: expected link to 'config.yaml' but got '%s' instead", c.name, linkTarget)
+		}
+	}
+}
+
+func TestParseOwner(t *testing.T) {
+	if o, err := parseOwner(""); err != nil || o != nil {
+		t.Errorf("empty owner should be nil but got %v, %v", o, err)
+	}
+	if o, err := parseOwner("1000:2000"); err != nil || o.uid != 1000 || o.gid != 2000 {
+		t.Errorf("expected owner 1000:2000 but got %v, %v", o, err)
+	}
+	if _, err := parseOwner("1000"); err == nil {
+		t.Errorf("owner without gid should have failed")
+	}
+}
+
+// fileIter iterates over files as they are.
+type fileIter struct {
+	files []*object.File
+}
+
+func (m *fileIter) ForEach(cb func(*object.File) error) error {
+	for _, f := range m.files {
+		if err := cb(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func assertMode(t *testing.T, name string, file string, mode os.FileMode) {
+	info, err := os.Lstat(file)
+	if err != nil {
+		t.Errorf("%s case failed: %v", name, err)
+		return
+	}
+	if info.Mode() != mode {
+		t.Errorf("%s case failed: expected '%s' to have mode '%s' but got '%s' instead", name, file, mode, info.Mode())
+	}
+}
+
+func TestFolderUploader_Sync(t *testing.T) {
+	config, _ := newMemoryFile("config.yaml", filemode.Regular, []byte("a: b\n"))
+	configChanged, _ := newMemoryFile("config.yaml", filemode.Regular, []byte("a: c\n"))
+	script, _ := newMemoryFile("run.sh", filemode.Regular, []byte("#!/bin/sh\n"))
+	scriptExecutable, _ := newMemoryFile("run.sh", filemode.Executable, []byte("#!/bin/sh\n"))
+	link, _ := newMemoryFile("link.yaml", filemode.Symlink, []byte("config.yaml"))
+
+	target := t.TempDir()
+	cu := &folderUploader{name: target}
+
+	steps := []struct {
+		name     string
+		files    []*object.File
+		added    int
+		modified int
+		deleted  int
+	}{
+		{name: "Initial", files: []*object.File{config, script, link}, added: 3},
+		{name: "Unchanged", files: []*object.File{config, script, link}},
+		{name: "Content changed", files: []*object.File{configChanged, script, link}, modified: 1},
+		{name: "Mode changed", files: []*object.File{configChanged, scriptExecutable, link}, modified: 1},
+		{name: "Deleted", files: []*object.File{configChanged}, deleted: 2},
+	}
+
+	for _, s := range steps {
+		files := make(map[string]*object.File)
+		for _, f := range s.files {
+			files[f.Name] = f
+		}
+
+		changes, err := cu.sync(target, files)
+		if err != nil {
+			t.Fatalf("%s step failed: %v", s.name, err)
+		}
+		if len(changes.added) != s.added || len(changes.modified) != s.modified || len(changes.deleted) != s.deleted {
+			t.Errorf("%s step failed: expected %d added, %d modified, %d deleted but got %s instead", s.name, s.added, s.modified, s.deleted, changes)
+		}
+	}
+}
+
+func TestFolderUploader_UploadAtomicUnchanged(t *testing.T) {
+	target := t.TempDir()
+	cu := &folderUploader{
+		name:      target,
+		includes:  []*regexp.Regexp{regexp.MustCompile(".*")},
+		atomic:    true,
+		revisions: 5,
+	}
+
+	for i := 0; i < 3; i++ {
+		iter := &mockFileIter{files: []*object.File{object.NewFile("test.json", filemode.Regular, &object.Blob{})}}
+		if err := cu.Upload(testCommit, iter); err != nil {
+			t.Fatalf("upload %d failed: %v", i, err)
+		}
+	}
+
+	revisions, err := os.ReadDir(filepath.Join(target, revisionsDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 {
+		t.Errorf("expected single revision for unchanged files but got %d revisions", len(revisions))
+	}
+}
+
+func TestCheckTarget(t *testing.T) {
+	cache := t.TempDir()
+	target := t.TempDir()
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(cache, link); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		target string
+		source string
+		fail   bool
+	}{
+		{name: "Separate", target: target, source: cache},
+		{name: "Missing target", target: filepath.Join(target, "a", "b"), source: cache},
+		{name: "Empty", target: "", source: cache, fail: true},
+		{name: "Root", target: "/", source: cache, fail: true},
+		{name: "Root unclean", target: "/tmp/..", source: cache, fail: true},
+		{name: "Cache", target: cache, source: cache, fail: true},
+		{name: "Inside cache", target: filepath.Join(cache, "out"), source: cache, fail: true},
+		{name: "Parent of cache", target: filepath.Dir(cache), source: cache, fail: true},
+		{name: "Cache through symlink", target: filepath.Join(link, "out"), source: cache, fail: true},
+	}
+
+	for _, c := range cases {
+		err := checkTarget(c.target, c.source)
+		if c.fail != (err != nil) {
+			t.Errorf("%s case failed: unexpected result %v", c.name, err)
+		}
+	}
+}
+
+func TestNewFolderUploader_KeepExisting(t *testing.T) {
+	cases := []struct {
+		name         string
+		keepExisting bool
+	}{
+		{name: "Remove existing"},
+		{name: "Keep existing", keepExisting: true},
+	}
+
+	for _, c := range cases {
+		target := t.TempDir()
+		existing := filepath.Join(target, "test.json")
+		if err := os.WriteFile(existing, []byte("{}"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := newFolderUploader(UploaderOptions{Target: target, Source: t.TempDir(), KeepExisting: c.keepExisting})
+		if err != nil {
+			t.Fatalf("%s case failed: %v", c.name, err)
+		}
+
+		_, err = os.Stat(existing)
+		if c.keepExisting != (err == nil) {
+			t.Errorf("%s case failed: unexpected existing file state %v", c.name, err)
+		}
+	}
+}
+
+func TestCheckFilePath(t *testing.T) {
+	cases := []struct {
+		name   string
+		file   string
+		mode   filemode.FileMode
+		target string
+		fail   bool
+	}{
+		{name: "Regular", file: "a/b.yaml", mode: filemode.Regular},
+		{name: "Parent reference", file: "../b.yaml", mode: filemode.Regular, fail: true},
+		{name: "Nested parent reference", file: "a/../../b.yaml", mode: filemode.Regular, fail: true},
+		{name: "Absolute", file: "/etc/passwd", mode: filemode.Regular, fail: true},
+		{name: "Empty", file: "", mode: filemode.Regular, fail: true},
+		{name: "Local symlink", file: "a/link", mode: filemode.Symlink, target: "../b.yaml"},
+		{name: "Escaping symlink", file: "a/link", mode: filemode.Symlink, target: "../../b.yaml", fail: true},
+		{name: "Absolute symlink", file: "link", mode: filemode.Symlink, target: "/etc/passwd", fail: true},
+	}
+
+	for _, c := range cases {
+		file, _ := newMemoryFile(c.file, c.mode, []byte(c.target))
+		err := checkFilePath(file)
+		if c.fail != (err != nil) {
+			t.Errorf("%s case failed: unexpected result %v", c.name, err)
+		}
+	}
+}
+
+func TestCheckSymlinks(t *testing.T) {
+	cases := []struct {
+		name  string
+		links map[string]string
+		fail  []string
+	}{
+		{
+			name:  "Local chain",
+			links: map[string]string{"a": "d/b", "d/b": "../c"},
+		},
+		{
+			name:  "Escaping chain",
+			links: map[string]string{"d/b": "..", "a": "d/b/.."},
+			fail:  []string{"a"},
+		},
+		{
+			name:  "Chain through escaping symlink",
+			links: map[string]string{"d/b": "../..", "a": "d/b/c"},
+			fail:  []string{"a", "d/b"},
+		},
+		{
+			name:  "Loop",
+			links: map[string]string{"a": "b", "b": "a"},
+			fail:  []string{"a", "b"},
+		},
+	}
+
+	for _, c := range cases {
+		errs := checkSymlinks(c.links)
+		if len(errs) != len(c.fail) {
+			t.Errorf("%s case failed: expected failed symlinks %v but got %v instead", c.name, c.fail, errs)
+		}
+		for _, name := range c.fail {
+			if errs[name] == nil {
+				t.Errorf("%s case failed: expected symlink '%s' to fail", c.name, name)
+			}
+		}
+	}
+}
+
+func TestFolderUploader_UploadTraversal(t *testing.T) {
+	outside := t.TempDir()
+	target := t.TempDir()
+	cu := &folderUploader{
+		name:     target,
+		includes: []*regexp.Regexp{regexp.MustCompile(".*")},
+	}
+
+	escaping, _ := newMemoryFile("../"+filepath.Base(outside)+"/escaped.yaml", filemode.Regular, []byte("a: b\n"))
+	link, _ := newMemoryFile("link", filemode.Symlink, []byte(outside))
+	config, _ := newMemoryFile("config.yaml", filemode.Regular, []byte("a: b\n"))
+	if err := cu.Upload(testCommit, &fileIter{files: []*object.File{escaping, link, config}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(outside, "escaped.yaml")); err == nil {
+		t.Errorf("file escaping target folder should have been skipped")
+	}
+	if _, err := os.Lstat(filepath.Join(target, "link")); err == nil {
+		t.Errorf("symlink pointing outside of target folder should have been skipped")
+	}
+	if _, err := os.Lstat(filepath.Join(target, "config.yaml")); err != nil {
+		t.Errorf("expected config.yaml in target folder: %v", err)
+	}
+
+	// Chain of symlinks that are local on their own must not escape either
+	parent, _ := newMemoryFile("d/b", filemode.Symlink, []byte(".."))
+	chain, _ := newMemoryFile("a", filemode.Symlink, []byte("d/b/.."))
+	if err := cu.Upload(testCommit, &fileIter{files: []*object.File{parent, chain, config}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(target, "a")); err == nil {
+		t.Errorf("symlink chain pointing outside of target folder should have been skipped")
+	}
+	if _, err := os.Lstat(filepath.Join(target, "d", "b")); err != nil {
+		t.Errorf("expected local symlink d/b in target folder: %v", err)
+	}
+
+	// Stale symlink left in target folder must be removed before writing files in its place
+	if err := os.Symlink(outside, filepath.Join(target, "dir")); err != nil {
+		t.Fatal(err)
+	}
+	nested, _ := newMemoryFile("dir/nested.yaml", filemode.Regular, []byte("a: b\n"))
+	if err := cu.Upload(testCommit, &fileIter{files: []*object.File{nested}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "nested.yaml")); err == nil {
+		t.Errorf("file should not have been written through stale symlink")
+	}
+	if info, err := os.Lstat(filepath.Join(target, "dir")); err != nil || !info.IsDir() {
+		t.Errorf("expected dir to be replaced by folder: %v", err)
+	}
+
+	if err := checkParents(outside, "dir/nested.yaml"); err != nil {
+		t.Errorf("unexpected error for missing parents: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(target, "other")); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkParents(target, "other/nested.yaml"); err == nil {
+		t.Errorf("writing through symlink should have failed")
+	}
+}
@@ -0,0 +1,124 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	hookCommitEnv       = "GIT2KUBE_COMMIT"
+	hookTargetEnv       = "GIT2KUBE_TARGET"
+	hookChangedFilesEnv = "GIT2KUBE_CHANGED_FILES"
+)
+
+// hook notifies consumers of the target folder about changes by running command and/or calling URL.
+type hook struct {
+	command string
+	url     string
+	timeout time.Duration
+	client  *http.Client
+}
+
+// hookPayload body of the HTTP hook request.
+type hookPayload struct {
+	Commit string   `json:"commit"`
+	Target string   `json:"target"`
+	Files  []string `json:"files"`
+}
+
+// newHook creates hook, nil is returned if neither command nor URL is configured.
+func newHook(command string, url string, timeout time.Duration) *hook {
+	if command == "" && url == "" {
+		return nil
+	}
+
+	return &hook{
+		command: command,
+		url:     url,
+		timeout: timeout,
+		client:  &http.Client{},
+	}
+}
+
+func (h *hook) run(commit *object.Commit, target string, files []string) error {
+	ctx := context.Background()
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	if h.command != "" {
+		if err := h.runCommand(ctx, commit, target, files); err != nil {
+			return err
+		}
+	}
+
+	if h.url != "" {
+		if err := h.callURL(ctx, commit, target, files); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *hook) runCommand(ctx context.Context, commit *object.Commit, target string, files []string) error {
+	log.Infof("Running hook command '%s'", h.command)
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", h.command) // #nosec G204
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("%s=%s", hookCommitEnv, commit.Hash),
+		fmt.Sprintf("%s=%s", hookTargetEnv, target),
+		fmt.Sprintf("%s=%s", hookChangedFilesEnv, strings.Join(files, "\n")),
+	)
+	// do not wait for orphaned children holding the output open after the timeout
+	cmd.WaitDelay = time.Second
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("hook command failed: %w: %s", err, output)
+	}
+
+	log.Debugf("Hook command output: %s", output)
+	return nil
+}
+
+func (h *hook) callURL(ctx context.Context, commit *object.Commit, target string, files []string) error {
+	log.Infof("Calling hook URL '%s'", h.url)
+	body, err := json.Marshal(hookPayload{
+		Commit: commit.Hash.String(),
+		Target: target,
+		Files:  files,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("hook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("hook request failed with status '%s'", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package upload
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestHook_RunCommand(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	h := newHook("echo \"$GIT2KUBE_COMMIT $GIT2KUBE_TARGET $GIT2KUBE_CHANGED_FILES\" > "+out, "", time.Second)
+
+	if err := h.run(testCommit, "/target", []string{"a.yaml", "b.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := testCommit.Hash.String() + " /target a.yaml\nb.yaml\n"
+	if string(content) != expected {
+		t.Errorf("expected hook output '%s' but got '%s' instead", expected, content)
+	}
+}
+
+func TestHook_RunCommandFailure(t *testing.T) {
+	cases := []struct {
+		name    string
+		command string
+	}{
+		{name: "Exit code", command: "exit 1"},
+		{name: "Timeout", command: "sleep 5"},
+	}
+
+	for _, c := range cases {
+		h := newHook(c.command, "", 100*time.Millisecond)
+		if err := h.run(testCommit, "/target", []string{"a.yaml"}); err == nil {
+			t.Errorf("%s case failed: expected error", c.name)
+		}
+	}
+}
+
+func TestHook_CallURL(t *testing.T) {
+	var payload hookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	h := newHook("", server.URL+"/reload", time.Second)
+	if err := h.run(testCommit, "/target", []string{"a.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := hookPayload{Commit: testCommit.Hash.String(), Target: "/target", Files: []string{"a.yaml"}}
+	if !reflect.DeepEqual(payload, expected) {
+		t.Errorf("expected payload '%v' but got '%v' instead", expected, payload)
+	}
+
+	h = newHook("", server.URL+"/fail", time.Second)
+	if err := h.run(testCommit, "/target", []string{"a.yaml"}); err == nil {
+		t.Errorf("expected error for failed request")
+	}
+}
+
+func TestFolderUploader_UploadHook(t *testing.T) {
+	target := t.TempDir()
+	marker := filepath.Join(t.TempDir(), "fail")
+	out := filepath.Join(t.TempDir(), "out")
+	cu := &folderUploader{
+		name:     target,
+		includes: []*regexp.Regexp{regexp.MustCompile(".*")},
+		hook:     newHook("test ! -e "+marker+" && echo \"$GIT2KUBE_CHANGED_FILES\" >> "+out, "", time.Second),
+	}
+
+	config, _ := newMemoryFile("config.yaml", filemode.Regular, []byte("a: b\n"))
+	configChanged, _ := newMemoryFile("config.yaml", filemode.Regular, []byte("a: c\n"))
+	script, _ := newMemoryFile("run.sh", filemode.Regular, []byte("#!/bin/sh\n"))
+
+	steps := []struct {
+		name   string
+		files  []*object.File
+		fail   bool
+		output string
+	}{
+		{name: "Initial", files: []*object.File{config}, output: "config.yaml\n"},
+		{name: "Unchanged", files: []*object.File{config}, output: "config.yaml\n"},
+		{name: "Failed", files: []*object.File{configChanged}, fail: true, output: "config.yaml\n"},
+		{name: "Retried", files: []*object.File{configChanged, script}, output: "config.yaml\nconfig.yaml\nrun.sh\n"},
+	}
+
+	for _, s := range steps {
+		if s.fail {
+			if err := os.WriteFile(marker, nil, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			_ = os.Remove(marker)
+		}
+
+		err := cu.Upload(testCommit, &fileIter{files: s.files})
+		if s.fail != (err != nil) {
+			t.Errorf("%s step failed: unexpected hook result %v", s.name, err)
+		}
+
+		content, _ := os.ReadFile(out)
+		if string(content) != s.output {
+			t.Errorf("%s step failed: expected hook output '%s' but got '%s' instead", s.name, s.output, content)
+		}
+	}
+}
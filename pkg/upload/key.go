@@ -0,0 +1,112 @@
+package upload
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// KeyStrategy how to derive ConfigMap/Secret keys from file paths.
+type KeyStrategy string
+
+const (
+	// PathKeyStrategy key is the whole file path with '/' replaced by separator.
+	PathKeyStrategy KeyStrategy = "path"
+	// BasenameKeyStrategy key is the file name without directories.
+	BasenameKeyStrategy KeyStrategy = "basename"
+)
+
+const defaultKeySeparator = "."
+
+// backReference matches \N capture group references in rename rules, $N can't be used as CLI args are env expanded.
+var backReference = regexp.MustCompile(`\\(\d+)`)
+
+type renameRule struct {
+	regex       *regexp.Regexp
+	replacement string
+}
+
+// keyNamer derives keys from file paths, zero value uses path strategy with '.' separator.
+type keyNamer struct {
+	strategy  KeyStrategy
+	separator string
+	renames   []renameRule
+}
+
+func newKeyNamer(strategy KeyStrategy, separator string, renames []string) (keyNamer, error) {
+	switch strategy {
+	case "", PathKeyStrategy, BasenameKeyStrategy:
+	default:
+		return keyNamer{}, fmt.Errorf("invalid key strategy '%s'", strategy)
+	}
+
+	rules := make([]renameRule, len(renames))
+	for i, r := range renames {
+		expr, replacement, ok := strings.Cut(r, "=")
+		if !ok {
+			return keyNamer{}, fmt.Errorf("rename rule '%s' does not contain required char '='", r)
+		}
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			return keyNamer{}, err
+		}
+		rules[i] = renameRule{regex: regex, replacement: backReference.ReplaceAllString(replacement, "$${$1}")}
+	}
+
+	return keyNamer{
+		strategy:  strategy,
+		separator: separator,
+		renames:   rules,
+	}, nil
+}
+
+// key returns valid ConfigMap/Secret key for file name.
+func (n keyNamer) key(name string) (string, error) {
+	for _, r := range n.renames {
+		name = r.regex.ReplaceAllString(name, r.replacement)
+	}
+
+	var key string
+	switch n.strategy {
+	case BasenameKeyStrategy:
+		key = path.Base(name)
+	default:
+		separator := n.separator
+		if separator == "" {
+			separator = defaultKeySeparator
+		}
+		key = strings.ReplaceAll(name, "/", separator)
+	}
+
+	if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+		return "", fmt.Errorf("invalid key '%s' for file '%s': %s", key, name, strings.Join(errs, ", "))
+	}
+
+	return key, nil
+}
+
+// keySources tracks which files produced which keys to detect collisions.
+type keySources map[string][]string
+
+func (s keySources) add(key string, file string) {
+	s[key] = append(s[key], file)
+}
+
+func (s keySources) collisions() error {
+	var msgs []string
+	for key, files := range s {
+		if len(files) > 1 {
+			msgs = append(msgs, fmt.Sprintf("'%s' <- ['%s']", key, strings.Join(files, "', '")))
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	sort.Strings(msgs)
+	return fmt.Errorf("key collisions detected: %s", strings.Join(msgs, ", "))
+}
@@ -0,0 +1,97 @@
+package upload
+
+import (
+	"testing"
+)
+
+func TestKeyNamer_Key(t *testing.T) {
+	cases := []struct {
+		name      string
+		strategy  KeyStrategy
+		separator string
+		renames   []string
+		file      string
+		result    string
+		err       bool
+	}{
+		{
+			name:   "Default",
+			file:   "a/b/c.yaml",
+			result: "a.b.c.yaml",
+		},
+		{
+			name:      "Path with separator",
+			strategy:  PathKeyStrategy,
+			separator: "_",
+			file:      "a/b/c.yaml",
+			result:    "a_b_c.yaml",
+		},
+		{
+			name:     "Basename",
+			strategy: BasenameKeyStrategy,
+			file:     "a/b/c.yaml",
+			result:   "c.yaml",
+		},
+		{
+			name:    "Rename with capture group",
+			renames: []string{`^config/(.*)\.yml=\1.yaml`},
+			file:    "config/app/c.yml",
+			result:  "app.c.yaml",
+		},
+		{
+			name: "Invalid key",
+			file: "a b.yaml",
+			err:  true,
+		},
+	}
+
+	for _, c := range cases {
+		namer, err := newKeyNamer(c.strategy, c.separator, c.renames)
+		if err != nil {
+			t.Errorf("%s case failed: %v", c.name, err)
+			continue
+		}
+
+		key, err := namer.key(c.file)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s case failed: expected error but got none", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s case failed: %v", c.name, err)
+			continue
+		}
+		if key != c.result {
+			t.Errorf("%s case failed: expected key '%s' but got '%s' instead", c.name, c.result, key)
+		}
+	}
+}
+
+func TestNewKeyNamer_Invalid(t *testing.T) {
+	if _, err := newKeyNamer("unknown", "", nil); err == nil {
+		t.Errorf("unknown strategy should have failed")
+	}
+	if _, err := newKeyNamer(PathKeyStrategy, "", []string{"no-separator"}); err == nil {
+		t.Errorf("rename rule without '=' should have failed")
+	}
+}
+
+func TestKeySources_Collisions(t *testing.T) {
+	sources := make(keySources)
+	sources.add("a.b.yaml", "a/b.yaml")
+	sources.add("c.yaml", "c.yaml")
+	if err := sources.collisions(); err != nil {
+		t.Errorf("unexpected collision: %v", err)
+	}
+
+	sources.add("a.b.yaml", "a.b.yaml")
+	err := sources.collisions()
+	if err == nil {
+		t.Fatalf("expected collision but got none")
+	}
+	if expected := "key collisions detected: 'a.b.yaml' <- ['a/b.yaml', 'a.b.yaml']"; err.Error() != expected {
+		t.Errorf("expected error '%s' but got '%s' instead", expected, err)
+	}
+}
@@ -0,0 +1,525 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+)
+
+const (
+	commitLabel    = "git2kube.github.com/commit"
+	inventoryLabel = "git2kube.github.com/inventory"
+	// inventoryKey key of the inventory ConfigMap holding the list of applied objects.
+	inventoryKey = "objects"
+	fieldManager = "git2kube"
+)
+
+// kindPriority kinds that have to be applied before the rest of the objects.
+var kindPriority = map[string]int{
+	"Namespace":                1,
+	"CustomResourceDefinition": 1,
+}
+
+type manifestsUploader struct {
+	clientset    kubernetes.Interface
+	dynamic      dynamic.Interface
+	mapper       meta.RESTMapper
+	namespace    string
+	name         string
+	labels       map[string]string
+	annotations  map[string]string
+	includes     []*regexp.Regexp
+	excludes     []*regexp.Regexp
+	ignoreFile   string
+	transformers []transformer
+	prune        bool
+}
+
+// objectRef reference to an applied object stored in the inventory.
+type objectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// objectKey identity of the object independent of the API version it was applied with.
+type objectKey struct {
+	group     string
+	kind      string
+	namespace string
+	name      string
+}
+
+// key returns identity of the referenced object, the same object can be served by multiple versions of its group.
+func (r objectRef) key() objectKey {
+	group := r.APIVersion
+	if gv, err := schema.ParseGroupVersion(r.APIVersion); err == nil {
+		group = gv.Group
+	}
+	return objectKey{group: group, kind: r.Kind, namespace: r.Namespace, name: r.Name}
+}
+
+func (r objectRef) String() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s '%s'", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s '%s.%s'", r.Kind, r.Namespace, r.Name)
+}
+
+func newManifestsUploader(o UploaderOptions) (Uploader, error) {
+	restconfig, err := restConfig(o.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(restconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(restconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	includesRegex, err := compileFilters(o.FilterSyntax, o.Includes)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Loaded include rules %s", includesRegex)
+
+	excludesRegex, err := compileFilters(o.FilterSyntax, o.Excludes)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Loaded exclude rules %s", excludesRegex)
+
+	labelsParsed, err := stringsToMap(o.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	annotationsParsed, err := stringsToMap(o.Annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := loadAgeIdentities(o.AgeKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ageDecryptRegex, err := stringsToRegExp(o.AgeDecrypt)
+	if err != nil {
+		return nil, err
+	}
+
+	envsubstRegex, err := stringsToRegExp(o.Envsubst)
+	if err != nil {
+		return nil, err
+	}
+
+	templatesRegex, err := stringsToRegExp(o.Templates)
+	if err != nil {
+		return nil, err
+	}
+
+	renderer, err := newTemplateRenderer(templatesRegex, o.TemplateValues, o.TemplateEnvAllow)
+	if err != nil {
+		return nil, err
+	}
+
+	validateRegex, err := stringsToRegExp(o.Validate)
+	if err != nil {
+		return nil, err
+	}
+
+	validator, err := newValidator(validateRegex, o.ValidateSchemas)
+	if err != nil {
+		return nil, err
+	}
+
+	return &manifestsUploader{
+		clientset:   clientset,
+		dynamic:     dynamicClient,
+		mapper:      restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient)),
+		namespace:   o.Namespace,
+		name:        o.Target,
+		labels:      labelsParsed,
+		annotations: annotationsParsed,
+		includes:    includesRegex,
+		excludes:    excludesRegex,
+		ignoreFile:  o.IgnoreFile,
+		transformers: []transformer{
+			newAgeDecrypter(ageDecryptRegex, identities),
+			newSopsDecrypter(identities),
+			newEnvSubstituter(envsubstRegex, o.EnvsubstAllow),
+			renderer,
+			validator,
+		},
+		prune: o.Prune,
+	}, nil
+}
+
+func (u *manifestsUploader) Upload(commit *object.Commit, iter FileIter) error {
+	commitID := commit.Hash.String()
+
+	objects, err := u.collect(commit, iter)
+	if err != nil {
+		return err
+	}
+
+	inventory, err := u.loadInventory()
+	if err != nil {
+		return err
+	}
+
+	applied := make([]objectRef, 0, len(objects))
+	for _, obj := range objects {
+		ref, err := u.apply(obj, commitID)
+		if err != nil {
+			// Keep tracking of previously applied objects so that they can still be pruned later
+			if err := u.saveInventory(mergeRefs(inventory, applied), commitID); err != nil {
+				log.Errorf("Failed to save inventory: %v", err)
+			}
+			return err
+		}
+		applied = append(applied, ref)
+	}
+
+	// Objects that were not pruned stay in the inventory so that they can be pruned once it is enabled
+	if !u.prune {
+		return u.saveInventory(mergeRefs(inventory, applied), commitID)
+	}
+	if err := u.pruneObjects(inventory, applied); err != nil {
+		if err := u.saveInventory(mergeRefs(inventory, applied), commitID); err != nil {
+			log.Errorf("Failed to save inventory: %v", err)
+		}
+		return err
+	}
+
+	return u.saveInventory(applied, commitID)
+}
+
+// collect parses objects from YAML and JSON files, objects that have to exist first are ordered first.
+func (u *manifestsUploader) collect(commit *object.Commit, iter FileIter) ([]*unstructured.Unstructured, error) {
+	ignore, err := readIgnoreRules(u.ignoreFile, commitFiles(commit))
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []*unstructured.Unstructured
+	err = iter.ForEach(func(file *object.File) error {
+		if !filterFile(file, u.includes, u.excludes, ignore) {
+			return nil
+		}
+
+		file, err := transformFile(commit, file, u.transformers)
+		if err != nil {
+			return err
+		}
+
+		if !isManifestFile(file.Name) {
+			log.Debugf("Skipping '%s', not a YAML or JSON file", file.Name)
+			return nil
+		}
+
+		parsed, err := parseManifests(file)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, parsed...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(objects, func(i, j int) bool {
+		return kindPriority[objects[i].GetKind()] > kindPriority[objects[j].GetKind()]
+	})
+	return objects, nil
+}
+
+// isManifestFile returns true if the file can contain manifests.
+func isManifestFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+// parseManifests parses all objects from possibly multi-document YAML or JSON file, lists are expanded.
+func parseManifests(file *object.File) ([]*unstructured.Unstructured, error) {
+	reader, err := file.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var objects []*unstructured.Unstructured
+	decoder := utilyaml.NewYAMLOrJSONDecoder(reader, 4096)
+	for i := 1; ; i++ {
+		content := make(map[string]interface{})
+		if err := decoder.Decode(&content); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objects, nil
+			}
+			return nil, fmt.Errorf("failed to parse manifest '%s' document %d: %w", file.Name, i, err)
+		}
+		if len(content) == 0 {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{Object: content}
+		if obj.IsList() {
+			list, err := obj.ToList()
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse manifest '%s' document %d: %w", file.Name, i, err)
+			}
+			for j := range list.Items {
+				if err := checkManifest(&list.Items[j]); err != nil {
+					return nil, fmt.Errorf("invalid manifest '%s' document %d item %d: %w", file.Name, i, j, err)
+				}
+				objects = append(objects, &list.Items[j])
+			}
+			continue
+		}
+		if err := checkManifest(obj); err != nil {
+			return nil, fmt.Errorf("invalid manifest '%s' document %d: %w", file.Name, i, err)
+		}
+		objects = append(objects, obj)
+	}
+}
+
+func checkManifest(obj *unstructured.Unstructured) error {
+	if obj.GetAPIVersion() == "" || obj.GetKind() == "" || obj.GetName() == "" {
+		return errors.New("apiVersion, kind and metadata.name are required")
+	}
+	return nil
+}
+
+// apply applies the object using server-side apply.
+func (u *manifestsUploader) apply(obj *unstructured.Unstructured, commitID string) (objectRef, error) {
+	mapping, err := u.mapping(obj.GroupVersionKind())
+	if err != nil {
+		return objectRef{}, err
+	}
+
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(u.namespace)
+		}
+	} else {
+		obj.SetNamespace("")
+	}
+
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	for k, v := range u.labels {
+		labels[k] = v
+	}
+	labels[commitLabel] = commitID
+	labels[inventoryLabel] = u.name
+	obj.SetLabels(labels)
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	for k, v := range u.annotations {
+		annotations[k] = v
+	}
+	annotations[refAnnotation] = commitID
+	obj.SetAnnotations(annotations)
+
+	ref := objectRef{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+	}
+	log.Infof("Applying %s", ref)
+
+	_, err = u.resource(mapping, obj.GetNamespace()).Apply(context.TODO(), obj.GetName(), obj, metav1.ApplyOptions{FieldManager: fieldManager, Force: true})
+	if err != nil {
+		return objectRef{}, fmt.Errorf("failed to apply %s: %w", ref, err)
+	}
+
+	return ref, nil
+}
+
+// pruneObjects deletes objects from inventory that were not applied, objects not managed by this inventory are skipped.
+func (u *manifestsUploader) pruneObjects(inventory []objectRef, applied []objectRef) error {
+	// Objects are compared without version so that moving an object to a new version does not prune it
+	keep := make(map[objectKey]bool, len(applied))
+	for _, ref := range applied {
+		keep[ref.key()] = true
+	}
+
+	// Delete in reverse order so that namespaces and CRDs go last
+	for i := len(inventory) - 1; i >= 0; i-- {
+		ref := inventory[i]
+		if keep[ref.key()] {
+			continue
+		}
+
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			return err
+		}
+		mapping, err := u.mapping(gv.WithKind(ref.Kind))
+		if meta.IsNoMatchError(err) {
+			log.Warnf("Skipping prune of %s, API is no longer available", ref)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		resource := u.resource(mapping, ref.Namespace)
+		current, err := resource.Get(context.TODO(), ref.Name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if current.GetLabels()[inventoryLabel] != u.name {
+			log.Warnf("Skipping prune of %s, it is not managed by inventory '%s'", ref, u.name)
+			continue
+		}
+
+		log.Infof("Pruning %s", ref)
+		err = resource.Delete(context.TODO(), ref.Name, metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("failed to prune %s: %w", ref, err)
+		}
+	}
+
+	return nil
+}
+
+func (u *manifestsUploader) resource(mapping *meta.RESTMapping, namespace string) dynamic.ResourceInterface {
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return u.dynamic.Resource(mapping.Resource).Namespace(namespace)
+	}
+	return u.dynamic.Resource(mapping.Resource)
+}
+
+// mapping returns REST mapping of the kind, discovery is refreshed once if the kind is unknown.
+func (u *manifestsUploader) mapping(gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	mapping, err := u.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		u.resetMapper()
+		mapping, err = u.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	return mapping, err
+}
+
+func (u *manifestsUploader) resetMapper() {
+	if mapper, ok := u.mapper.(meta.ResettableRESTMapper); ok {
+		mapper.Reset()
+	}
+}
+
+// loadInventory loads references of objects applied by the previous upload.
+func (u *manifestsUploader) loadInventory() ([]objectRef, error) {
+	configMap, err := u.clientset.CoreV1().ConfigMaps(u.namespace).Get(context.TODO(), u.name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []objectRef
+	if data := configMap.Data[inventoryKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &refs); err != nil {
+			return nil, fmt.Errorf("failed to parse inventory ConfigMap '%s.%s': %w", u.namespace, u.name, err)
+		}
+	}
+	return refs, nil
+}
+
+// saveInventory stores references of applied objects into the inventory ConfigMap.
+func (u *manifestsUploader) saveInventory(refs []objectRef, commitID string) error {
+	data, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
+
+	configMaps := u.clientset.CoreV1().ConfigMaps(u.namespace)
+	configMap, err := configMaps.Get(context.TODO(), u.name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		_, err = configMaps.Create(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        u.name,
+				Namespace:   u.namespace,
+				Labels:      map[string]string{inventoryLabel: u.name},
+				Annotations: map[string]string{refAnnotation: commitID},
+			},
+			Data: map[string]string{inventoryKey: string(data)},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	configMap = configMap.DeepCopy()
+	if configMap.Annotations == nil {
+		configMap.Annotations = make(map[string]string)
+	}
+	configMap.Annotations[refAnnotation] = commitID
+	configMap.Data = map[string]string{inventoryKey: string(data)}
+	_, err = configMaps.Update(context.TODO(), configMap, metav1.UpdateOptions{})
+	return err
+}
+
+// mergeRefs returns union of the references keeping their order, references in b replace references to the same
+// object in a so that objects moved to a new version are tracked only once.
+func mergeRefs(a []objectRef, b []objectRef) []objectRef {
+	index := make(map[objectKey]int, len(a)+len(b))
+	merged := make([]objectRef, 0, len(a)+len(b))
+	for _, ref := range append(append([]objectRef{}, a...), b...) {
+		if i, ok := index[ref.key()]; ok {
+			merged[i] = ref
+			continue
+		}
+		index[ref.key()] = len(merged)
+		merged = append(merged, ref)
+	}
+	return merged
+}
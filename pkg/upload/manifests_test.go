@@ -0,0 +1,283 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	testing2 "k8s.io/client-go/testing"
+)
+
+// resetCountingMapper counts discovery refreshes of the mapper.
+type resetCountingMapper struct {
+	meta.RESTMapper
+	resets int
+}
+
+func (m *resetCountingMapper) Reset() {
+	m.resets++
+}
+
+func newTestMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	return mapper
+}
+
+func TestParseManifests(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		kinds   []string
+		fail    bool
+	}{
+		{name: "Single", content: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n", kinds: []string{"ConfigMap"}},
+		{name: "Multiple documents", content: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n---\n---\napiVersion: v1\nkind: Namespace\nmetadata:\n  name: b\n", kinds: []string{"ConfigMap", "Namespace"}},
+		{name: "JSON", content: `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a"}}`, kinds: []string{"ConfigMap"}},
+		{name: "Missing name", content: "apiVersion: v1\nkind: ConfigMap\n", fail: true},
+		{name: "Invalid", content: "apiVersion: [v1\n", fail: true},
+	}
+
+	for _, c := range cases {
+		file, _ := newMemoryFile("test.yaml", filemode.Regular, []byte(c.content))
+		objects, err := parseManifests(file)
+		if c.fail != (err != nil) {
+			t.Errorf("%s case failed: unexpected result %v", c.name, err)
+			continue
+		}
+
+		var kinds []string
+		for _, obj := range objects {
+			kinds = append(kinds, obj.GetKind())
+		}
+		if !reflect.DeepEqual(kinds, c.kinds) {
+			t.Errorf("%s case failed: expected kinds %v but got %v instead", c.name, c.kinds, kinds)
+		}
+	}
+}
+
+func TestManifestsUploader_Upload(t *testing.T) {
+	pruned := &unstructured.Unstructured{}
+	pruned.SetAPIVersion("v1")
+	pruned.SetKind("ConfigMap")
+	pruned.SetNamespace("default")
+	pruned.SetName("pruned")
+	pruned.SetLabels(map[string]string{inventoryLabel: "inventory"})
+
+	foreign := pruned.DeepCopy()
+	foreign.SetName("foreign")
+	foreign.SetLabels(nil)
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), pruned, foreign)
+	var applied []*unstructured.Unstructured
+	dynamicClient.PrependReactor("patch", "*", func(action testing2.Action) (bool, runtime.Object, error) {
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(action.(testing2.PatchAction).GetPatch()); err != nil {
+			return true, nil, err
+		}
+		applied = append(applied, obj)
+		return true, obj, nil
+	})
+
+	inventory, _ := json.Marshal([]objectRef{
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "pruned"},
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "foreign"},
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "app"},
+	})
+	clientset := testclient.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "inventory", Namespace: "default"},
+		Data:       map[string]string{inventoryKey: string(inventory)},
+	})
+
+	u := &manifestsUploader{
+		clientset: clientset,
+		dynamic:   dynamicClient,
+		mapper:    newTestMapper(),
+		namespace: "default",
+		name:      "inventory",
+		labels:    map[string]string{"app": "git2kube"},
+		includes:  []*regexp.Regexp{regexp.MustCompile(".*")},
+		prune:     true,
+	}
+
+	iter := &mockFileIter{files: []*object.File{object.NewFile("manifests.yaml", filemode.Regular, &object.Blob{})}}
+	if err := u.Upload(testCommit, iter); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []objectRef{
+		{APIVersion: "v1", Kind: "Namespace", Name: "apps"},
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "app"},
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "apps", Name: "other"},
+	}
+	var refs []objectRef
+	for _, obj := range applied {
+		refs = append(refs, objectRef{APIVersion: obj.GetAPIVersion(), Kind: obj.GetKind(), Namespace: obj.GetNamespace(), Name: obj.GetName()})
+		if obj.GetLabels()[commitLabel] != testCommit.Hash.String() || obj.GetLabels()[inventoryLabel] != "inventory" || obj.GetLabels()["app"] != "git2kube" {
+			t.Errorf("unexpected labels %v of applied %s", obj.GetLabels(), obj.GetName())
+		}
+	}
+	if !reflect.DeepEqual(refs, expected) {
+		t.Errorf("expected applied objects %v but got %v instead", expected, refs)
+	}
+
+	var deleted []string
+	for _, action := range dynamicClient.Actions() {
+		if action.GetVerb() == "delete" {
+			deleted = append(deleted, action.(testing2.DeleteAction).GetName())
+		}
+	}
+	if !reflect.DeepEqual(deleted, []string{"pruned"}) {
+		t.Errorf("expected only 'pruned' to be deleted but got %v instead", deleted)
+	}
+
+	saved, err := u.loadInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(saved, expected) {
+		t.Errorf("expected inventory %v but got %v instead", expected, saved)
+	}
+
+	configMap, _ := clientset.CoreV1().ConfigMaps("default").Get(context.TODO(), "inventory", metav1.GetOptions{})
+	if configMap.Annotations[refAnnotation] != testCommit.Hash.String() {
+		t.Errorf("expected inventory to reference commit but got %v instead", configMap.Annotations)
+	}
+}
+
+func TestManifestsUploader_UploadChangedVersion(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "autoscaling", Version: "v2beta2", Kind: "HorizontalPodAutoscaler"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "autoscaling", Version: "v2", Kind: "HorizontalPodAutoscaler"}, meta.RESTScopeNamespace)
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	var current *unstructured.Unstructured
+	dynamicClient.PrependReactor("patch", "*", func(action testing2.Action) (bool, runtime.Object, error) {
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(action.(testing2.PatchAction).GetPatch()); err != nil {
+			return true, nil, err
+		}
+		current = obj
+		return true, obj, nil
+	})
+	// Both versions are served, the applied object is returned by either of them
+	dynamicClient.PrependReactor("get", "*", func(action testing2.Action) (bool, runtime.Object, error) {
+		return true, current, nil
+	})
+
+	u := &manifestsUploader{
+		clientset: testclient.NewSimpleClientset(),
+		dynamic:   dynamicClient,
+		mapper:    mapper,
+		namespace: "default",
+		name:      "inventory",
+		includes:  []*regexp.Regexp{regexp.MustCompile(".*")},
+		prune:     true,
+	}
+
+	for _, version := range []string{"autoscaling/v2beta2", "autoscaling/v2"} {
+		file, err := newMemoryFile("hpa.yaml", filemode.Regular, []byte("apiVersion: "+version+"\nkind: HorizontalPodAutoscaler\nmetadata:\n  name: app\n  namespace: default\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := u.Upload(testCommit, &fileIter{files: []*object.File{file}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, action := range dynamicClient.Actions() {
+		if action.GetVerb() == "delete" {
+			t.Errorf("expected object moved to new version to be kept but it was deleted through %s", action.GetResource())
+		}
+	}
+
+	saved, err := u.loadInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []objectRef{{APIVersion: "autoscaling/v2", Kind: "HorizontalPodAutoscaler", Namespace: "default", Name: "app"}}
+	if !reflect.DeepEqual(saved, expected) {
+		t.Errorf("expected inventory %v but got %v instead", expected, saved)
+	}
+}
+
+func TestManifestsUploader_UploadWithoutPrune(t *testing.T) {
+	pruned := &unstructured.Unstructured{}
+	pruned.SetAPIVersion("v1")
+	pruned.SetKind("ConfigMap")
+	pruned.SetNamespace("default")
+	pruned.SetName("pruned")
+	pruned.SetLabels(map[string]string{inventoryLabel: "inventory"})
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), pruned)
+	dynamicClient.PrependReactor("patch", "*", func(action testing2.Action) (bool, runtime.Object, error) {
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(action.(testing2.PatchAction).GetPatch()); err != nil {
+			return true, nil, err
+		}
+		return true, obj, nil
+	})
+
+	inventory, _ := json.Marshal([]objectRef{{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "pruned"}})
+	clientset := testclient.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "inventory", Namespace: "default"},
+		Data:       map[string]string{inventoryKey: string(inventory)},
+	})
+
+	mapper := &resetCountingMapper{RESTMapper: newTestMapper()}
+	u := &manifestsUploader{
+		clientset: clientset,
+		dynamic:   dynamicClient,
+		mapper:    mapper,
+		namespace: "default",
+		name:      "inventory",
+		includes:  []*regexp.Regexp{regexp.MustCompile(".*")},
+	}
+
+	// Objects that were not pruned are kept in the inventory until pruning is enabled
+	for _, prune := range []bool{false, true} {
+		u.prune = prune
+		iter := &mockFileIter{files: []*object.File{object.NewFile("manifests.yaml", filemode.Regular, &object.Blob{})}}
+		if err := u.Upload(testCommit, iter); err != nil {
+			t.Fatal(err)
+		}
+
+		saved, err := u.loadInventory()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tracked := false
+		for _, ref := range saved {
+			tracked = tracked || ref.Name == "pruned"
+		}
+		if tracked == prune {
+			t.Errorf("expected 'pruned' tracked in inventory to be %t with prune %t but got %v", !prune, prune, saved)
+		}
+	}
+
+	var deleted []string
+	for _, action := range dynamicClient.Actions() {
+		if action.GetVerb() == "delete" {
+			deleted = append(deleted, action.(testing2.DeleteAction).GetName())
+		}
+	}
+	if !reflect.DeepEqual(deleted, []string{"pruned"}) {
+		t.Errorf("expected 'pruned' to be deleted once prune is enabled but got %v instead", deleted)
+	}
+	if mapper.resets != 0 {
+		t.Errorf("expected discovery not to be refreshed for known kinds but it was refreshed %d times", mapper.resets)
+	}
+}
@@ -0,0 +1,103 @@
+package upload
+
+import (
+	"encoding/json"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// managedMetadataAnnotation records labels and annotations set by git2kube so that they can be removed
+// once dropped from configuration.
+const managedMetadataAnnotation = "git2kube.github.com/managed-metadata"
+
+// managedKeysAnnotation records data keys written by git2kube so that Owned merge removes only those.
+const managedKeysAnnotation = "git2kube.github.com/managed-keys"
+
+// managedMetadata keys of labels and annotations managed by git2kube.
+type managedMetadata struct {
+	Labels      []string `json:"labels,omitempty"`
+	Annotations []string `json:"annotations,omitempty"`
+}
+
+// applyMetadata sets labels and annotations on the object and removes the ones that were managed previously
+// but are no longer configured, metadata set by others is left untouched.
+func applyMetadata(meta *metav1.ObjectMeta, labels map[string]string, annotations map[string]string) error {
+	var previous managedMetadata
+	if value, ok := meta.Annotations[managedMetadataAnnotation]; ok {
+		if err := json.Unmarshal([]byte(value), &previous); err != nil {
+			log.Warnf("Ignoring invalid %s annotation of '%s.%s': %v", managedMetadataAnnotation, meta.Namespace, meta.Name, err)
+		}
+	}
+
+	meta.Labels = mergeOwned(meta.Labels, labels, previous.Labels)
+	meta.Annotations = mergeOwned(meta.Annotations, annotations, previous.Annotations)
+
+	managed, err := json.Marshal(managedMetadata{
+		Labels:      sortedKeysOf(labels),
+		Annotations: sortedKeysOf(annotations),
+	})
+	if err != nil {
+		return err
+	}
+	meta.Annotations[managedMetadataAnnotation] = string(managed)
+	return nil
+}
+
+// managedKeys returns data keys written by git2kube during the previous sync.
+func managedKeys(meta metav1.ObjectMeta) []string {
+	value, ok := meta.Annotations[managedKeysAnnotation]
+	if !ok {
+		log.Warnf("Missing %s annotation of '%s.%s', no keys will be removed", managedKeysAnnotation, meta.Namespace, meta.Name)
+		return nil
+	}
+
+	var keys []string
+	if err := json.Unmarshal([]byte(value), &keys); err != nil {
+		log.Warnf("Ignoring invalid %s annotation of '%s.%s': %v", managedKeysAnnotation, meta.Namespace, meta.Name, err)
+		return nil
+	}
+	return keys
+}
+
+// setManagedKeys records data keys written by git2kube.
+func setManagedKeys(meta *metav1.ObjectMeta, keys []string) error {
+	value, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = make(map[string]string)
+	}
+	meta.Annotations[managedKeysAnnotation] = string(value)
+	return nil
+}
+
+// mergeOwned returns current with data upserted and keys previously managed by git2kube but missing in data removed,
+// keys written by others are left untouched.
+func mergeOwned[V any](current map[string]V, data map[string]V, previous []string) map[string]V {
+	result := make(map[string]V, len(current)+len(data))
+	for k, v := range current {
+		result[k] = v
+	}
+	for _, k := range previous {
+		if _, ok := data[k]; !ok {
+			log.Debugf("Removing no longer managed key '%s'", k)
+			delete(result, k)
+		}
+	}
+	for k, v := range data {
+		result[k] = v
+	}
+	return result
+}
+
+func sortedKeysOf[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,169 @@
+package upload
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestApplyMetadata(t *testing.T) {
+	cases := []struct {
+		name          string
+		meta          metav1.ObjectMeta
+		labels        map[string]string
+		annotations   map[string]string
+		exlabels      map[string]string
+		exannotations map[string]string
+	}{
+		{
+			name:          "New object",
+			labels:        map[string]string{"a": "1"},
+			annotations:   map[string]string{"b": "2"},
+			exlabels:      map[string]string{"a": "1"},
+			exannotations: map[string]string{"b": "2", managedMetadataAnnotation: `{"labels":["a"],"annotations":["b"]}`},
+		},
+		{
+			name: "Dropped metadata",
+			meta: metav1.ObjectMeta{
+				Labels:      map[string]string{"a": "1", "dropped": "x", "foreign": "y"},
+				Annotations: map[string]string{"dropped": "x", "foreign": "y", managedMetadataAnnotation: `{"labels":["a","dropped"],"annotations":["dropped"]}`},
+			},
+			labels:        map[string]string{"a": "2"},
+			annotations:   map[string]string{},
+			exlabels:      map[string]string{"a": "2", "foreign": "y"},
+			exannotations: map[string]string{"foreign": "y", managedMetadataAnnotation: `{"labels":["a"]}`},
+		},
+		{
+			name: "Unmanaged object",
+			meta: metav1.ObjectMeta{
+				Labels:      map[string]string{"foreign": "y"},
+				Annotations: map[string]string{"foreign": "y"},
+			},
+			labels:        map[string]string{},
+			annotations:   map[string]string{},
+			exlabels:      map[string]string{"foreign": "y"},
+			exannotations: map[string]string{"foreign": "y", managedMetadataAnnotation: `{}`},
+		},
+	}
+
+	for _, c := range cases {
+		if err := applyMetadata(&c.meta, c.labels, c.annotations); err != nil {
+			t.Fatalf("%s case failed: %v", c.name, err)
+		}
+		if !reflect.DeepEqual(c.meta.Labels, c.exlabels) {
+			t.Errorf("%s case failed: expected labels %v but got %v instead", c.name, c.exlabels, c.meta.Labels)
+		}
+		if !reflect.DeepEqual(c.meta.Annotations, c.exannotations) {
+			t.Errorf("%s case failed: expected annotations %v but got %v instead", c.name, c.exannotations, c.meta.Annotations)
+		}
+	}
+}
+
+func TestConfigmapUploader_UploadDroppedLabel(t *testing.T) {
+	fakeclient := testclient.NewSimpleClientset()
+	cu := &configmapUploader{
+		clientset:   fakeclient,
+		namespace:   "default",
+		name:        "git2kube",
+		labels:      map[string]string{"team": "a", "dropped": "x"},
+		annotations: map[string]string{},
+		mergeType:   Delete,
+	}
+	if err := cu.Upload(testCommit, &mockFileIter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	configMaps := fakeclient.CoreV1().ConfigMaps("default")
+	configMap, _ := configMaps.Get(context.TODO(), "git2kube", metav1.GetOptions{})
+	configMap.Labels["foreign"] = "y"
+	if _, err := configMaps.Update(context.TODO(), configMap, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	cu.labels = map[string]string{"team": "a"}
+	if err := cu.Upload(testCommit, &mockFileIter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, _ := configMaps.Get(context.TODO(), "git2kube", metav1.GetOptions{})
+	expected := map[string]string{"team": "a", "foreign": "y"}
+	if !reflect.DeepEqual(res.Labels, expected) {
+		t.Errorf("expected labels %v but got %v instead", expected, res.Labels)
+	}
+}
+
+func TestConfigmapUploader_UploadOwned(t *testing.T) {
+	cases := []struct {
+		name     string
+		existing map[string]string
+		managed  string
+		data     map[string]string // test.json is always uploaded
+	}{
+		{
+			name:     "Removed owned key",
+			existing: map[string]string{"removed.json": "x", "test.json": "old", "foreign": "y"},
+			managed:  `["removed.json","test.json"]`,
+			data:     map[string]string{"foreign": "y"},
+		},
+		{
+			name:     "Missing managed keys",
+			existing: map[string]string{"removed.json": "x", "foreign": "y"},
+			data:     map[string]string{"removed.json": "x", "foreign": "y"},
+		},
+		{
+			name:     "Invalid managed keys",
+			existing: map[string]string{"removed.json": "x"},
+			managed:  `removed.json`,
+			data:     map[string]string{"removed.json": "x"},
+		},
+	}
+
+	content, err := os.ReadFile(filepath.Join("testdata", "test.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range cases {
+		c.data["test.json"] = string(content)
+		annotations := map[string]string{}
+		if c.managed != "" {
+			annotations[managedKeysAnnotation] = c.managed
+		}
+		existing := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "git2kube", Namespace: "default", Annotations: annotations},
+			Data:       c.existing,
+		}
+		fakeclient := testclient.NewSimpleClientset(existing)
+		cu := &configmapUploader{
+			clientset:   fakeclient,
+			namespace:   "default",
+			name:        "git2kube",
+			labels:      map[string]string{},
+			annotations: map[string]string{},
+			includes:    []*regexp.Regexp{regexp.MustCompile(".*")},
+			mergeType:   Owned,
+		}
+		iter := &mockFileIter{files: []*object.File{object.NewFile("test.json", filemode.Regular, &object.Blob{})}}
+		if err := cu.Upload(testCommit, iter); err != nil {
+			t.Errorf("%s case failed: %v", c.name, err)
+			continue
+		}
+
+		res, _ := fakeclient.CoreV1().ConfigMaps("default").Get(context.TODO(), "git2kube", metav1.GetOptions{})
+		if !reflect.DeepEqual(res.Data, c.data) {
+			t.Errorf("%s case failed: expected data %v but got %v instead", c.name, c.data, res.Data)
+		}
+		if res.Annotations[managedKeysAnnotation] != `["test.json"]` {
+			t.Errorf("%s case failed: expected managed keys '[\"test.json\"]' but got '%s' instead", c.name, res.Annotations[managedKeysAnnotation])
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// namespaceSelector selects namespaces the targets are replicated into.
+type namespaceSelector struct {
+	names    []string
+	selector labels.Selector
+	prune    bool
+}
+
+// newNamespaceSelector creates selector of the listed namespaces and namespaces matching label selector,
+// nil is returned if neither is configured.
+func newNamespaceSelector(names []string, selector string, prune bool) (*namespaceSelector, error) {
+	if len(names) == 0 && selector == "" {
+		return nil, nil
+	}
+
+	for _, name := range names {
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid namespace '%s': %s", name, strings.Join(errs, ", "))
+		}
+	}
+
+	var parsed labels.Selector
+	if selector != "" {
+		var err error
+		parsed, err = labels.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace selector '%s': %w", selector, err)
+		}
+	}
+	log.Infof("Replicating into namespaces %v and namespaces matching '%s'", names, selector)
+
+	return &namespaceSelector{
+		names:    names,
+		selector: parsed,
+		prune:    prune,
+	}, nil
+}
+
+// resolve returns sorted names of the selected namespaces, namespaces matching the label selector are listed
+// with every call so that namespaces created at runtime are picked up.
+func (s *namespaceSelector) resolve(clientset kubernetes.Interface, defaultNamespace string) ([]string, error) {
+	if s == nil {
+		return []string{defaultNamespace}, nil
+	}
+
+	selected := make(map[string]bool)
+	for _, name := range s.names {
+		selected[name] = true
+	}
+
+	if s.selector != nil {
+		list, err := clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{LabelSelector: s.selector.String()})
+		if err != nil {
+			return nil, newUploadError("list", "Namespace", metav1.NamespaceAll, s.selector.String(), err)
+		}
+		for _, namespace := range list.Items {
+			if namespace.Status.Phase == corev1.NamespaceTerminating {
+				continue
+			}
+			selected[namespace.Name] = true
+		}
+	}
+
+	names := make([]string, 0, len(selected))
+	for name := range selected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// stale returns true if copies in namespace should be removed as it is no longer selected.
+func (s *namespaceSelector) stale(namespace string, selected []string) bool {
+	if s == nil || !s.prune {
+		return false
+	}
+	i := sort.SearchStrings(selected, namespace)
+	return i == len(selected) || selected[i] != namespace
+}
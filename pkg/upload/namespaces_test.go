@@ -0,0 +1,109 @@
+package upload
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestNamespace(name string, labels map[string]string, phase corev1.NamespacePhase) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Status:     corev1.NamespaceStatus{Phase: phase},
+	}
+}
+
+func TestNamespaceSelector_Resolve(t *testing.T) {
+	fakeclient := testclient.NewSimpleClientset(
+		newTestNamespace("tenant-a", map[string]string{"tenant": "true"}, corev1.NamespaceActive),
+		newTestNamespace("tenant-b", map[string]string{"tenant": "true"}, corev1.NamespaceTerminating),
+		newTestNamespace("system", nil, corev1.NamespaceActive),
+	)
+
+	cases := []struct {
+		name       string
+		names      []string
+		selector   string
+		namespaces []string
+	}{
+		{name: "Default", namespaces: []string{"default"}},
+		{name: "List", names: []string{"b", "a"}, namespaces: []string{"a", "b"}},
+		{name: "Selector", selector: "tenant=true", namespaces: []string{"tenant-a"}},
+		{name: "List and selector", names: []string{"tenant-a", "system"}, selector: "tenant", namespaces: []string{"system", "tenant-a"}},
+	}
+
+	for _, c := range cases {
+		s, err := newNamespaceSelector(c.names, c.selector, false)
+		if err != nil {
+			t.Fatalf("%s case failed: %v", c.name, err)
+		}
+
+		namespaces, err := s.resolve(fakeclient, "default")
+		if err != nil {
+			t.Errorf("%s case failed: %v", c.name, err)
+		}
+		if !reflect.DeepEqual(namespaces, c.namespaces) {
+			t.Errorf("%s case failed: expected namespaces %v but got %v instead", c.name, c.namespaces, namespaces)
+		}
+	}
+}
+
+func TestNewNamespaceSelector(t *testing.T) {
+	if _, err := newNamespaceSelector([]string{"Invalid_Name"}, "", false); err == nil {
+		t.Errorf("invalid namespace should have failed")
+	}
+	if _, err := newNamespaceSelector(nil, "tenant in (", false); err == nil {
+		t.Errorf("invalid selector should have failed")
+	}
+}
+
+func TestConfigmapUploader_UploadNamespaces(t *testing.T) {
+	owned := map[string]string{ownerLabel: "default.git2kube"}
+	fakeclient := testclient.NewSimpleClientset(
+		newTestNamespace("tenant-a", map[string]string{"tenant": "true"}, corev1.NamespaceActive),
+		newTestNamespace("tenant-b", map[string]string{"tenant": "true"}, corev1.NamespaceActive),
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "git2kube", Namespace: "former", Labels: owned}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "git2kube", Namespace: "unrelated"}},
+		// Copy of the same name replicated by instance syncing from another namespace
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "git2kube", Namespace: "other", Labels: map[string]string{ownerLabel: "system.git2kube"}}},
+	)
+
+	s, _ := newNamespaceSelector(nil, "tenant=true", true)
+	cu := &configmapUploader{
+		clientset:   fakeclient,
+		namespace:   "default",
+		name:        "git2kube",
+		labels:      owned,
+		annotations: map[string]string{},
+		includes:    []*regexp.Regexp{regexp.MustCompile(".*")},
+		mergeType:   Delete,
+		namespaces:  s,
+	}
+
+	file, _ := newMemoryFile("ca.crt", filemode.Regular, []byte("ca"))
+	if err := cu.Upload(testCommit, &fileIter{files: []*object.File{file}}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := fakeclient.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var namespaces []string
+	for _, cm := range list.Items {
+		namespaces = append(namespaces, cm.Namespace)
+	}
+	sort.Strings(namespaces)
+	expected := []string{"other", "tenant-a", "tenant-b", "unrelated"}
+	if !reflect.DeepEqual(namespaces, expected) {
+		t.Errorf("expected ConfigMaps in namespaces %v but got %v instead", expected, namespaces)
+	}
+}
@@ -0,0 +1,158 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// autoOwnerReference discovers owner of the created objects from the controller of the running pod.
+	autoOwnerReference = "auto"
+
+	podNameEnv      = "POD_NAME"
+	podNamespaceEnv = "POD_NAMESPACE"
+)
+
+// ownerReference reference to the workload owning created objects.
+type ownerReference struct {
+	namespace string
+	ref       metav1.OwnerReference
+}
+
+// newOwnerReference resolves owner in format KIND/NAME in namespace or discovers it if owner is 'auto',
+// nil is returned if owner is empty.
+func newOwnerReference(clientset kubernetes.Interface, owner string, namespace string) (*ownerReference, error) {
+	if owner == "" {
+		return nil, nil
+	}
+
+	var (
+		ref *ownerReference
+		err error
+	)
+	if owner == autoOwnerReference {
+		ref, err = podControllerReference(clientset)
+	} else {
+		kind, name, ok := strings.Cut(owner, "/")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid owner reference '%s', expected format KIND/NAME or '%s'", owner, autoOwnerReference)
+		}
+		ref, err = workloadReference(clientset, kind, name, namespace)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ref.namespace != namespace {
+		return nil, fmt.Errorf("owner %s '%s.%s' is not in target namespace '%s', owner references can't cross namespaces", ref.ref.Kind, ref.namespace, ref.ref.Name, namespace)
+	}
+
+	log.Infof("Setting owner reference to %s '%s.%s'", ref.ref.Kind, ref.namespace, ref.ref.Name)
+	return ref, nil
+}
+
+// workloadReference returns reference to the apps/v1 workload.
+func workloadReference(clientset kubernetes.Interface, kind string, name string, namespace string) (*ownerReference, error) {
+	var (
+		meta metav1.Object
+		err  error
+	)
+	apps := clientset.AppsV1()
+	switch strings.ToLower(kind) {
+	case "deployment":
+		kind = "Deployment"
+		meta, err = apps.Deployments(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	case "statefulset":
+		kind = "StatefulSet"
+		meta, err = apps.StatefulSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	case "daemonset":
+		kind = "DaemonSet"
+		meta, err = apps.DaemonSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	default:
+		return nil, fmt.Errorf("unsupported owner kind '%s' (options: Deployment|StatefulSet|DaemonSet)", kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve owner %s '%s.%s': %w", kind, namespace, name, err)
+	}
+
+	return &ownerReference{
+		namespace: namespace,
+		ref: metav1.OwnerReference{
+			APIVersion: "apps/v1",
+			Kind:       kind,
+			Name:       meta.GetName(),
+			UID:        meta.GetUID(),
+		},
+	}, nil
+}
+
+// podControllerReference returns reference to the controller of the running pod identified by POD_NAME
+// and POD_NAMESPACE environment variables, ReplicaSets are followed to their Deployment and Jobs to their CronJob.
+func podControllerReference(clientset kubernetes.Interface) (*ownerReference, error) {
+	name, namespace := os.Getenv(podNameEnv), os.Getenv(podNamespaceEnv)
+	if name == "" || namespace == "" {
+		return nil, fmt.Errorf("%s and %s environment variables have to be set using downward API to discover owner", podNameEnv, podNamespaceEnv)
+	}
+
+	pod, err := clientset.CoreV1().Pods(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover owner of pod '%s.%s': %w", namespace, name, err)
+	}
+	controller := metav1.GetControllerOf(pod)
+	if controller == nil {
+		return nil, fmt.Errorf("pod '%s.%s' is not managed by a controller", namespace, name)
+	}
+
+	// Short-lived controllers would delete the objects with them
+	var (
+		owned metav1.Object
+		kind  = controller.Kind
+	)
+	switch {
+	case kind == "ReplicaSet" && controller.APIVersion == "apps/v1":
+		owned, err = clientset.AppsV1().ReplicaSets(namespace).Get(context.TODO(), controller.Name, metav1.GetOptions{})
+	case kind == "Job" && controller.APIVersion == "batch/v1":
+		owned, err = clientset.BatchV1().Jobs(namespace).Get(context.TODO(), controller.Name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover owner of %s '%s.%s': %w", kind, namespace, controller.Name, err)
+	}
+	if owned != nil {
+		if parent := metav1.GetControllerOf(owned); parent != nil {
+			controller = parent
+		}
+	}
+
+	return &ownerReference{
+		namespace: namespace,
+		ref: metav1.OwnerReference{
+			APIVersion: controller.APIVersion,
+			Kind:       controller.Kind,
+			Name:       controller.Name,
+			UID:        controller.UID,
+		},
+	}, nil
+}
+
+// apply returns refs with the owner reference added, owner references can't cross namespaces so objects
+// in other namespaces are left as they are.
+func (o *ownerReference) apply(namespace string, refs []metav1.OwnerReference) []metav1.OwnerReference {
+	if o == nil {
+		return refs
+	}
+	if namespace != o.namespace {
+		log.Debugf("Skipping owner reference in namespace '%s', owner is in namespace '%s'", namespace, o.namespace)
+		return refs
+	}
+	for _, ref := range refs {
+		if ref.UID == o.ref.UID {
+			return refs
+		}
+	}
+	return append(append([]metav1.OwnerReference{}, refs...), o.ref)
+}
@@ -0,0 +1,146 @@
+package upload
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func controllerRef(apiVersion string, kind string, name string, uid types.UID) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: name, UID: uid, Controller: &controller}}
+}
+
+func TestNewOwnerReference(t *testing.T) {
+	fakeclient := testclient.NewSimpleClientset(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "watcher", Namespace: "config", UID: "deployment-uid"}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name: "watcher-1", Namespace: "config", UID: "rs-uid",
+			OwnerReferences: controllerRef("apps/v1", "Deployment", "watcher", "deployment-uid"),
+		}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "watcher-1-a", Namespace: "config",
+			OwnerReferences: controllerRef("apps/v1", "ReplicaSet", "watcher-1", "rs-uid"),
+		}},
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "stateful", Namespace: "config", UID: "sts-uid"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "stateful-0", Namespace: "config",
+			OwnerReferences: controllerRef("apps/v1", "StatefulSet", "stateful", "sts-uid"),
+		}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "standalone", Namespace: "config"}},
+		&batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "loader", Namespace: "config", UID: "cronjob-uid"}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+			Name: "loader-1", Namespace: "config", UID: "job-uid",
+			OwnerReferences: controllerRef("batch/v1", "CronJob", "loader", "cronjob-uid"),
+		}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "loader-1-a", Namespace: "config",
+			OwnerReferences: controllerRef("batch/v1", "Job", "loader-1", "job-uid"),
+		}},
+	)
+
+	cases := []struct {
+		name      string
+		owner     string
+		pod       string
+		namespace string
+		kind      string
+		uid       types.UID
+		fail      bool
+	}{
+		{name: "Named Deployment", owner: "Deployment/watcher", kind: "Deployment", uid: "deployment-uid"},
+		{name: "Named StatefulSet", owner: "statefulset/stateful", kind: "StatefulSet", uid: "sts-uid"},
+		{name: "Missing Deployment", owner: "Deployment/missing", fail: true},
+		{name: "Unsupported kind", owner: "Job/watcher", fail: true},
+		{name: "Invalid format", owner: "watcher", fail: true},
+		{name: "Auto Deployment", owner: "auto", pod: "watcher-1-a", kind: "Deployment", uid: "deployment-uid"},
+		{name: "Auto StatefulSet", owner: "auto", pod: "stateful-0", kind: "StatefulSet", uid: "sts-uid"},
+		{name: "Auto CronJob", owner: "auto", pod: "loader-1-a", kind: "CronJob", uid: "cronjob-uid"},
+		{name: "Auto in other namespace", owner: "auto", pod: "watcher-1-a", namespace: "monitoring", fail: true},
+		{name: "Auto without controller", owner: "auto", pod: "standalone", fail: true},
+		{name: "Auto without downward API", owner: "auto", fail: true},
+	}
+
+	for _, c := range cases {
+		t.Setenv(podNameEnv, c.pod)
+		t.Setenv(podNamespaceEnv, "config")
+
+		namespace := "config"
+		if c.namespace != "" {
+			namespace = c.namespace
+		}
+		ref, err := newOwnerReference(fakeclient, c.owner, namespace)
+		if c.fail != (err != nil) {
+			t.Errorf("%s case failed: unexpected result %v", c.name, err)
+			continue
+		}
+		if c.fail {
+			continue
+		}
+		if ref.ref.Kind != c.kind || ref.ref.UID != c.uid || ref.namespace != "config" {
+			t.Errorf("%s case failed: expected %s '%s' but got %v instead", c.name, c.kind, c.uid, ref)
+		}
+	}
+
+	if ref, err := newOwnerReference(fakeclient, "", "config"); ref != nil || err != nil {
+		t.Errorf("empty owner should not set owner reference")
+	}
+}
+
+func TestConfigmapUploader_UploadOwnerReference(t *testing.T) {
+	owner := &ownerReference{
+		namespace: "config",
+		ref:       metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "watcher", UID: "deployment-uid"},
+	}
+	existing := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "config", Annotations: map[string]string{}}}
+
+	cases := []struct {
+		name      string
+		namespace string
+		target    string
+		refs      []metav1.OwnerReference
+	}{
+		{name: "Created", namespace: "config", target: "git2kube", refs: []metav1.OwnerReference{owner.ref}},
+		{name: "Patched", namespace: "config", target: "existing", refs: []metav1.OwnerReference{owner.ref}},
+		{name: "Other namespace", namespace: "other", target: "git2kube"},
+	}
+
+	for _, c := range cases {
+		fakeclient := testclient.NewSimpleClientset(existing)
+		cu := &configmapUploader{
+			clientset:   fakeclient,
+			namespace:   c.namespace,
+			name:        c.target,
+			labels:      map[string]string{},
+			annotations: map[string]string{},
+			includes:    []*regexp.Regexp{regexp.MustCompile(".*")},
+			mergeType:   Delete,
+			owner:       owner,
+		}
+
+		file, _ := newMemoryFile("config.yaml", filemode.Regular, []byte("a: b\n"))
+		for i := 0; i < 2; i++ {
+			if err := cu.Upload(testCommit, &fileIter{files: []*object.File{file}}); err != nil {
+				t.Fatalf("%s case failed: %v", c.name, err)
+			}
+		}
+
+		res, err := fakeclient.CoreV1().ConfigMaps(c.namespace).Get(context.TODO(), c.target, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("%s case failed: %v", c.name, err)
+		}
+		if !reflect.DeepEqual(res.OwnerReferences, c.refs) {
+			t.Errorf("%s case failed: expected owner references %v but got %v instead", c.name, c.refs, res.OwnerReferences)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// repositoryAnnotation URL of the synced repository without credentials.
+	repositoryAnnotation = "git2kube.github.com/repository"
+	// branchAnnotation synced branch.
+	branchAnnotation = "git2kube.github.com/branch"
+	// authorAnnotation author of the synced commit.
+	authorAnnotation = "git2kube.github.com/author"
+	// commitTimeAnnotation time the synced commit was authored.
+	commitTimeAnnotation = "git2kube.github.com/commit-time"
+	// syncTimeAnnotation time the current commit or content was synced.
+	syncTimeAnnotation = "git2kube.github.com/sync-time"
+	// checksumAnnotation SHA-256 checksum of the synced data.
+	checksumAnnotation = "git2kube.github.com/checksum"
+)
+
+// provenance source of the synced data recorded in annotations.
+type provenance struct {
+	repository string
+	branch     string
+}
+
+// newProvenance creates provenance of the repository, credentials are stripped from its URL.
+func newProvenance(repository string, branch string) provenance {
+	return provenance{
+		repository: stripCredentials(repository),
+		branch:     branch,
+	}
+}
+
+// stripCredentials removes user info from the repository URL, scp-like addresses are returned as they are.
+func stripCredentials(repository string) string {
+	parsed, err := url.Parse(repository)
+	if err != nil || parsed.Scheme == "" || parsed.User == nil {
+		return repository
+	}
+	parsed.User = nil
+	return parsed.String()
+}
+
+// annotate sets provenance annotations of the commit and checksum of the data, sync time is updated only
+// if the commit or checksum changed so that unchanged objects are not rewritten on every sync.
+func (p provenance) annotate(meta *metav1.ObjectMeta, commit *object.Commit, checksum string) {
+	if meta.Annotations == nil {
+		meta.Annotations = make(map[string]string)
+	}
+	commitID := commit.Hash.String()
+	changed := !isSynced(*meta, commitID, checksum)
+
+	meta.Annotations[refAnnotation] = commitID
+	meta.Annotations[checksumAnnotation] = checksum
+	meta.Annotations[authorAnnotation] = fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email)
+	meta.Annotations[commitTimeAnnotation] = commit.Author.When.UTC().Format(time.RFC3339)
+	if p.repository != "" {
+		meta.Annotations[repositoryAnnotation] = p.repository
+	}
+	if p.branch != "" {
+		meta.Annotations[branchAnnotation] = p.branch
+	}
+	if changed || meta.Annotations[syncTimeAnnotation] == "" {
+		meta.Annotations[syncTimeAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	}
+}
+
+// isSynced returns true if the object already records sync of the commit with the same checksum.
+func isSynced(meta metav1.ObjectMeta, commitID string, checksum string) bool {
+	return meta.Annotations[refAnnotation] == commitID && meta.Annotations[checksumAnnotation] == checksum
+}
+
+// checksum returns stable SHA-256 checksum of data computed over sorted keys and values.
+func checksum[V string | []byte](data map[string]V) string {
+	h := sha256.New()
+	for _, k := range sortedKeysOf(data) {
+		v := data[k]
+		// Length prefixes keep the encoding unambiguous
+		fmt.Fprintf(h, "%d:%s%d:", len(k), k, len(v))
+		h.Write([]byte(v))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,134 @@
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/aes"
+	sopsage "github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/config"
+	"github.com/getsops/sops/v3/stores/dotenv"
+	"github.com/getsops/sops/v3/stores/json"
+	"github.com/getsops/sops/v3/stores/yaml"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+)
+
+// sopsEncryptedMarker prefix of every value encrypted by SOPS.
+const sopsEncryptedMarker = "ENC[AES256_GCM,"
+
+type sopsStore interface {
+	sops.EncryptedFileLoader
+	sops.PlainFileEmitter
+}
+
+// sopsDecrypter decrypts SOPS encrypted YAML, JSON and dotenv files using age identities.
+type sopsDecrypter struct {
+	identities []age.Identity
+}
+
+func newSopsDecrypter(identities []age.Identity) *sopsDecrypter {
+	return &sopsDecrypter{identities: identities}
+}
+
+func (d *sopsDecrypter) transform(_ *object.Commit, file *object.File) (*object.File, error) {
+	store := sopsStoreForPath(file.Name)
+	if store == nil {
+		return file, nil
+	}
+
+	content, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := store.LoadEncryptedFile([]byte(content))
+	if err != nil {
+		// Never let anything that looks like ciphertext through
+		if !strings.Contains(content, sopsEncryptedMarker) {
+			return file, nil
+		}
+		return nil, fmt.Errorf("failed to load SOPS file '%s': %w", file.Name, err)
+	}
+
+	plain, err := d.decrypt(tree, store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt SOPS file '%s': %w", file.Name, err)
+	}
+	log.Debugf("Decrypted SOPS file '%s'", file.Name)
+
+	return newMemoryFile(file.Name, file.Mode, plain)
+}
+
+func (d *sopsDecrypter) decrypt(tree sops.Tree, store sopsStore) ([]byte, error) {
+	key, err := d.dataKey(tree.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	cipher := aes.NewCipher()
+	mac, err := tree.Decrypt(key, cipher)
+	if err != nil {
+		return nil, err
+	}
+
+	originalMac, err := cipher.Decrypt(
+		tree.Metadata.MessageAuthenticationCode,
+		key,
+		tree.Metadata.LastModified.Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt MAC: %w", err)
+	}
+	if originalMac != mac {
+		return nil, errors.New("failed to verify data integrity, MAC mismatch")
+	}
+
+	return store.EmitPlainFile(tree.Branches)
+}
+
+func (d *sopsDecrypter) dataKey(metadata sops.Metadata) ([]byte, error) {
+	if len(d.identities) == 0 {
+		return nil, errors.New("no age identities configured")
+	}
+	if len(metadata.KeyGroups) > 1 {
+		return nil, errors.New("files with multiple key groups are not supported")
+	}
+
+	for _, group := range metadata.KeyGroups {
+		for _, key := range group {
+			ageKey, ok := key.(*sopsage.MasterKey)
+			if !ok {
+				continue
+			}
+
+			r, err := age.Decrypt(armor.NewReader(strings.NewReader(ageKey.EncryptedKey)), d.identities...)
+			if err != nil {
+				log.Debugf("Unable to decrypt data key for recipient '%s': %v", ageKey.Recipient, err)
+				continue
+			}
+			return io.ReadAll(r)
+		}
+	}
+
+	return nil, errors.New("none of the configured age identities matches the file recipients")
+}
+
+func sopsStoreForPath(name string) sopsStore {
+	switch {
+	case strings.HasSuffix(name, ".yaml"), strings.HasSuffix(name, ".yml"):
+		return yaml.NewStore(&config.YAMLStoreConfig{})
+	case strings.HasSuffix(name, ".json"):
+		return json.NewStore(&config.JSONStoreConfig{})
+	case strings.HasSuffix(name, ".env"):
+		return dotenv.NewStore(&config.DotenvStoreConfig{})
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,147 @@
+package upload
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSopsDecrypter_Transform(t *testing.T) {
+	identities, err := loadAgeIdentities("testdata/age.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherIdentity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name       string
+		file       string
+		identities []age.Identity
+		contains   []string
+		err        bool
+	}{
+		{
+			name:       "SOPS YAML",
+			file:       "sops.yaml",
+			identities: identities,
+			contains:   []string{"username: admin", "password: s3cr3t"},
+		},
+		{
+			name:       "SOPS JSON",
+			file:       "sops.json",
+			identities: identities,
+			contains:   []string{`"token": "abc"`},
+		},
+		{
+			name:       "SOPS dotenv",
+			file:       "sops.env",
+			identities: identities,
+			contains:   []string{"API_KEY=xyz"},
+		},
+		{
+			name:       "Plain YAML",
+			file:       "test.yaml",
+			identities: identities,
+		},
+		{
+			name:       "SOPS YAML without metadata",
+			file:       "sops-stripped.yaml",
+			identities: identities,
+			err:        true,
+		},
+		{
+			name: "SOPS YAML without identities",
+			file: "sops.yaml",
+			err:  true,
+		},
+		{
+			name:       "SOPS YAML with wrong identity",
+			file:       "sops.yaml",
+			identities: []age.Identity{otherIdentity},
+			err:        true,
+		},
+	}
+
+	for _, c := range cases {
+		content, err := os.ReadFile("testdata/" + c.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := newMemoryFile(c.file, filemode.Regular, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := newSopsDecrypter(c.identities).transform(testCommit, file)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s case failed: expected error but got none", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s case failed: %v", c.name, err)
+			continue
+		}
+
+		decrypted, _ := res.Contents()
+		if strings.Contains(decrypted, sopsEncryptedMarker) || strings.Contains(decrypted, "sops") {
+			t.Errorf("%s case failed: result still contains SOPS data '%s'", c.name, decrypted)
+		}
+		for _, s := range c.contains {
+			if !strings.Contains(decrypted, s) {
+				t.Errorf("%s case failed: expected '%s' in '%s'", c.name, s, decrypted)
+			}
+		}
+	}
+}
+
+func TestSecretUploader_UploadSops(t *testing.T) {
+	identities, err := loadAgeIdentities("testdata/age.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fakeclient := testclient.NewSimpleClientset()
+	cu := &secretUploader{
+		clientset:    fakeclient,
+		namespace:    "default",
+		name:         "git2kube",
+		mergeType:    Delete,
+		labels:       map[string]string{},
+		annotations:  map[string]string{},
+		transformers: []transformer{newSopsDecrypter(nil)},
+	}
+	cu.includes, _ = stringsToRegExp([]string{".*"})
+	iter := &mockFileIter{files: []*object.File{object.NewFile("sops.yaml", filemode.Regular, &object.Blob{})}}
+
+	if err := cu.Upload(testCommit, iter); err == nil {
+		t.Errorf("upload without identities should have failed")
+	}
+	if len(fakeclient.Actions()) != 0 {
+		t.Errorf("upload without identities should not have touched the cluster, got %v", fakeclient.Actions())
+	}
+
+	cu.transformers = []transformer{newSopsDecrypter(identities)}
+	if err := cu.Upload(testCommit, iter); err != nil {
+		t.Errorf("upload failed: %v", err)
+	}
+
+	res, err := fakeclient.CoreV1().Secrets("default").Get(context.TODO(), "git2kube", v1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(res.Data["sops.yaml"]), "password: s3cr3t") {
+		t.Errorf("expected decrypted data but got '%s' instead", res.Data["sops.yaml"])
+	}
+}
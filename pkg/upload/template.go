@@ -0,0 +1,103 @@
+package upload
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"text/template"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// templateRenderer renders files matching patterns as Go text/template.
+type templateRenderer struct {
+	patterns []*regexp.Regexp
+	values   map[string]interface{}
+	env      map[string]string
+}
+
+// templateData data available to the rendered templates.
+type templateData struct {
+	Values map[string]interface{}
+	Env    map[string]string
+	Commit templateCommit
+}
+
+type templateCommit struct {
+	Hash    string
+	Author  string
+	Email   string
+	Date    time.Time
+	Message string
+}
+
+// newTemplateRenderer creates renderer of templates, only environment variables in envAllow are available
+// as .Env so that templates from the repository can't read credentials of the pod.
+func newTemplateRenderer(patterns []*regexp.Regexp, valuesFile string, envAllow []string) (*templateRenderer, error) {
+	values := make(map[string]interface{})
+	if valuesFile != "" {
+		content, err := os.ReadFile(valuesFile) // #nosec G304
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(content, &values); err != nil {
+			return nil, fmt.Errorf("failed to parse template values '%s': %w", valuesFile, err)
+		}
+		log.Infof("Loaded template values from '%s'", valuesFile)
+	}
+
+	env := make(map[string]string)
+	for _, name := range envAllow {
+		if value, ok := os.LookupEnv(name); ok {
+			env[name] = value
+		} else {
+			log.Warnf("Variable '%s' allowed in templates is not set", name)
+		}
+	}
+
+	return &templateRenderer{
+		patterns: patterns,
+		values:   values,
+		env:      env,
+	}, nil
+}
+
+func (r *templateRenderer) transform(commit *object.Commit, file *object.File) (*object.File, error) {
+	if !matchesAny(file.Name, r.patterns) {
+		return file, nil
+	}
+
+	content, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(file.Name).Option("missingkey=error").Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template '%s': %w", file.Name, err)
+	}
+
+	data := templateData{
+		Values: r.values,
+		Env:    r.env,
+		Commit: templateCommit{
+			Hash:    commit.Hash.String(),
+			Author:  commit.Author.Name,
+			Email:   commit.Author.Email,
+			Date:    commit.Author.When,
+			Message: commit.Message,
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render template '%s': %w", file.Name, err)
+	}
+	log.Debugf("Rendered template '%s'", file.Name)
+
+	return newMemoryFile(file.Name, file.Mode, buf.Bytes())
+}
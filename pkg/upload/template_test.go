@@ -0,0 +1,110 @@
+package upload
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+)
+
+func TestTemplateRenderer_Transform(t *testing.T) {
+	t.Setenv("GIT2KUBE_TEST_CLUSTER", "prod")
+	t.Setenv("GIT2KUBE_TEST_SECRET", "secret")
+
+	renderer, err := newTemplateRenderer([]*regexp.Regexp{regexp.MustCompile(`\.tmpl$`)}, "testdata/values.yaml", []string{"GIT2KUBE_TEST_CLUSTER", "GIT2KUBE_TEST_MISSING"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		file    string
+		content string
+		result  string
+		err     bool
+	}{
+		{
+			name:    "Values",
+			file:    "config.tmpl",
+			content: "host: {{ .Values.hostname }}\nreplicas: {{ .Values.replicas }}",
+			result:  "host: example.com\nreplicas: 3",
+		},
+		{
+			name:    "Env",
+			file:    "config.tmpl",
+			content: "cluster: {{ .Env.GIT2KUBE_TEST_CLUSTER }}",
+			result:  "cluster: prod",
+		},
+		{
+			name:    "Commit",
+			file:    "config.tmpl",
+			content: "{{ .Commit.Hash }} {{ .Commit.Author }} {{ .Commit.Date.Year }}",
+			result:  "0123456789abcdef0123456789abcdef01234567 Test 2020",
+		},
+		{
+			name:    "Not matching file",
+			file:    "config.yaml",
+			content: "host: {{ .Values.hostname }}",
+			result:  "host: {{ .Values.hostname }}",
+		},
+		{
+			name:    "Missing value",
+			file:    "config.tmpl",
+			content: "host: {{ .Values.missing }}",
+			err:     true,
+		},
+		{
+			name:    "Missing env",
+			file:    "config.tmpl",
+			content: "host: {{ .Env.GIT2KUBE_TEST_MISSING }}",
+			err:     true,
+		},
+		{
+			name:    "Env not allowed",
+			file:    "config.tmpl",
+			content: "token: {{ .Env.GIT2KUBE_TEST_SECRET }}",
+			err:     true,
+		},
+		{
+			name:    "Env not allowed by index",
+			file:    "config.tmpl",
+			content: "token: {{ index .Env \"GIT2KUBE_TEST_SECRET\" }}",
+			result:  "token: ",
+		},
+		{
+			name:    "Env listed",
+			file:    "config.tmpl",
+			content: "{{ range $k, $v := .Env }}{{ $k }} {{ end }}",
+			result:  "GIT2KUBE_TEST_CLUSTER ",
+		},
+		{
+			name:    "Invalid template",
+			file:    "config.tmpl",
+			content: "host: {{ .Values.hostname",
+			err:     true,
+		},
+	}
+
+	for _, c := range cases {
+		file, err := newMemoryFile(c.file, filemode.Regular, []byte(c.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := renderer.transform(testCommit, file)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s case failed: expected error but got none", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s case failed: %v", c.name, err)
+			continue
+		}
+
+		if rendered, _ := res.Contents(); rendered != c.result {
+			t.Errorf("%s case failed: expected '%s' but got '%s' instead", c.name, c.result, rendered)
+		}
+	}
+}
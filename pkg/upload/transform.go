@@ -0,0 +1,40 @@
+package upload
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// transformer modifies files before they are uploaded to target.
+type transformer interface {
+	// transform returns the file of the commit that should be uploaded instead of the original one
+	transform(commit *object.Commit, file *object.File) (*object.File, error)
+}
+
+func transformFile(commit *object.Commit, file *object.File, transformers []transformer) (*object.File, error) {
+	var err error
+	for _, t := range transformers {
+		file, err = t.transform(commit, file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return file, nil
+}
+
+func newMemoryFile(name string, mode filemode.FileMode, content []byte) (*object.File, error) {
+	obj := &plumbing.MemoryObject{}
+	obj.SetType(plumbing.BlobObject)
+	if _, err := obj.Write(content); err != nil {
+		return nil, err
+	}
+
+	blob, err := object.DecodeBlob(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.NewFile(name, mode, blob), nil
+}
@@ -1,21 +1,20 @@
 package upload
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"os"
-	"path"
-	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"dario.cat/mergo"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
@@ -23,11 +22,11 @@ import (
 	typedcore "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
 )
 
 const (
 	refAnnotation = "git2kube.github.com/ref"
-	bufferSize    = 1024
 )
 
 // LoadType upload type.
@@ -40,7 +39,9 @@ const (
 	// Delete merge all keys (files) including removal of missing keys.
 	Delete MergeType = "delete"
 	// Upsert merge all keys (files) but don't remove missing keys from the repository.
-	Upsert = "upsert"
+	Upsert MergeType = "upsert"
+	// Owned merge all keys (files) and remove only missing keys previously written by git2kube.
+	Owned MergeType = "owned"
 )
 
 // LoadType options enum.
@@ -48,6 +49,7 @@ const (
 	ConfigMap LoadType = iota
 	Secret
 	Folder
+	Manifests
 )
 
 // FileIter provides an iterator for the files in a tree.
@@ -60,44 +62,106 @@ type UploaderFactory func(o UploaderOptions) (Uploader, error)
 
 // Uploader uploading data to target.
 type Uploader interface {
-	// Upload files into config map tagged by commitID
-	Upload(commitID string, iter FileIter) error
+	// Upload files of the commit into target
+	Upload(commit *object.Commit, iter FileIter) error
+}
+
+// Reporter reports objects written by the last Upload.
+type Reporter interface {
+	// Results of the last Upload
+	Results() []Result
+}
+
+// Result object written by Upload.
+type Result struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Commit    string `json:"commit"`
+	Checksum  string `json:"checksum"`
+}
+
+func newResult(kind string, meta metav1.ObjectMeta, commit *object.Commit, checksum string) Result {
+	return Result{
+		Kind:      kind,
+		Namespace: meta.Namespace,
+		Name:      meta.Name,
+		Commit:    commit.Hash.String(),
+		Checksum:  checksum,
+	}
 }
 
 type uploader struct {
-	restconfig  *rest.Config
-	clientset   kubernetes.Interface
-	namespace   string
-	name        string
-	mergeType   MergeType
-	labels      map[string]string
-	annotations map[string]string
-	includes    []*regexp.Regexp
-	excludes    []*regexp.Regexp
+	restconfig   *rest.Config
+	clientset    kubernetes.Interface
+	namespace    string
+	name         string
+	mergeType    MergeType
+	labels       map[string]string
+	annotations  map[string]string
+	includes     []*regexp.Regexp
+	excludes     []*regexp.Regexp
+	ignoreFile   string
+	transformers []transformer
+	keys         keyNamer
+	fanout       *fanout
+	namespaces   *namespaceSelector
+	owner        *ownerReference
+	events       *eventRecorder
+	provenance   provenance
+	results      []Result
+	// changed whether the last Upload modified any object
+	changed bool
 }
 
 type configmapUploader uploader
 
 type secretUploader uploader
 
-type folderUploader struct {
-	name       string
-	includes   []*regexp.Regexp
-	excludes   []*regexp.Regexp
-	sourcePath string
-}
-
 // UploaderOptions uploader options.
 type UploaderOptions struct {
-	Kubeconfig  bool
-	Source      string
-	Target      string
-	Namespace   string
-	MergeType   MergeType
-	Includes    []string
-	Excludes    []string
-	Labels      []string
-	Annotations []string
+	Kubeconfig        bool
+	Repository        string
+	Branch            string
+	Source            string
+	Target            string
+	Namespace         string
+	MergeType         MergeType
+	FilterSyntax      FilterSyntax
+	Includes          []string
+	Excludes          []string
+	IgnoreFile        string
+	Labels            []string
+	Annotations       []string
+	AgeKeyFile        string
+	AgeDecrypt        []string
+	Templates         []string
+	TemplateValues    string
+	TemplateEnvAllow  []string
+	Validate          []string
+	ValidateSchemas   []string
+	Envsubst          []string
+	EnvsubstAllow     []string
+	KeyStrategy       KeyStrategy
+	KeySeparator      string
+	KeyRenames        []string
+	Atomic            bool
+	Revisions         int
+	FileMode          string
+	DirMode           string
+	Owner             string
+	KeepExisting      bool
+	SplitDepth        int
+	Namespaces        []string
+	NamespaceSelector string
+	PruneNamespaces   bool
+	OwnerReference    string
+	NameTemplate      string
+	Prune             bool
+	HookCommand       string
+	HookURL           string
+	HookTimeout       time.Duration
+	Events            bool
 }
 
 var uploaderFactories = make(map[LoadType]UploaderFactory)
@@ -121,7 +185,21 @@ func NewUploader(lt LoadType, o UploaderOptions) (Uploader, error) {
 	return engineFactory(o)
 }
 
+// checkMergeType returns error if the merge type is not one of the supported options.
+func checkMergeType(mergeType MergeType) error {
+	switch mergeType {
+	case Delete, Upsert, Owned:
+		return nil
+	default:
+		return fmt.Errorf("invalid merge type '%s' (options: delete|upsert|owned)", mergeType)
+	}
+}
+
 func newConfigMapUploader(o UploaderOptions) (Uploader, error) {
+	if err := checkMergeType(o.MergeType); err != nil {
+		return nil, err
+	}
+
 	restconfig, err := restConfig(o.Kubeconfig)
 	if err != nil {
 		return nil, err
@@ -132,13 +210,13 @@ func newConfigMapUploader(o UploaderOptions) (Uploader, error) {
 		return nil, err
 	}
 
-	includesRegex, err := stringsToRegExp(o.Includes)
+	includesRegex, err := compileFilters(o.FilterSyntax, o.Includes)
 	if err != nil {
 		return nil, err
 	}
 	log.Infof("Loaded include rules %s", includesRegex)
 
-	excludesRegex, err := stringsToRegExp(o.Excludes)
+	excludesRegex, err := compileFilters(o.FilterSyntax, o.Excludes)
 	if err != nil {
 		return nil, err
 	}
@@ -154,10 +232,77 @@ func newConfigMapUploader(o UploaderOptions) (Uploader, error) {
 		return nil, err
 	}
 
+	keys, err := newKeyNamer(o.KeyStrategy, o.KeySeparator, o.KeyRenames)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := newFanout(o.SplitDepth, o.NameTemplate, o.Target)
+	if err != nil {
+		return nil, err
+	}
+	namespaces, err := newNamespaceSelector(o.Namespaces, o.NamespaceSelector, o.PruneNamespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	if targets != nil || namespaces != nil {
+		owner, err := ownerValue(o.Namespace, o.Target)
+		if err != nil {
+			return nil, err
+		}
+		labelsParsed[ownerLabel] = owner
+	}
+
+	ownerRef, err := newOwnerReference(clientset, o.OwnerReference, o.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if ownerRef != nil && namespaces != nil {
+		log.Warnf("Owner reference is set only on objects in namespace '%s', owner references can't cross namespaces", o.Namespace)
+	}
+
+	envsubstRegex, err := stringsToRegExp(o.Envsubst)
+	if err != nil {
+		return nil, err
+	}
+
+	templatesRegex, err := stringsToRegExp(o.Templates)
+	if err != nil {
+		return nil, err
+	}
+
+	renderer, err := newTemplateRenderer(templatesRegex, o.TemplateValues, o.TemplateEnvAllow)
+	if err != nil {
+		return nil, err
+	}
+
+	validateRegex, err := stringsToRegExp(o.Validate)
+	if err != nil {
+		return nil, err
+	}
+
+	validator, err := newValidator(validateRegex, o.ValidateSchemas)
+	if err != nil {
+		return nil, err
+	}
+
 	return &configmapUploader{
-		mergeType:   o.MergeType,
-		includes:    includesRegex,
-		excludes:    excludesRegex,
+		mergeType:  o.MergeType,
+		includes:   includesRegex,
+		excludes:   excludesRegex,
+		ignoreFile: o.IgnoreFile,
+		transformers: []transformer{
+			newEnvSubstituter(envsubstRegex, o.EnvsubstAllow),
+			renderer,
+			validator,
+		},
+		keys:        keys,
+		fanout:      targets,
+		namespaces:  namespaces,
+		owner:       ownerRef,
+		events:      newEventRecorder(clientset, o.Events),
+		provenance:  newProvenance(o.Repository, o.Branch),
 		labels:      labelsParsed,
 		annotations: annotationsParsed,
 		restconfig:  restconfig,
@@ -167,31 +312,128 @@ func newConfigMapUploader(o UploaderOptions) (Uploader, error) {
 	}, nil
 }
 
-func (u *configmapUploader) Upload(commitID string, iter FileIter) error {
-	configMaps := u.clientset.CoreV1().ConfigMaps(u.namespace)
+func (u *configmapUploader) Upload(commit *object.Commit, iter FileIter) error {
+	err := u.upload(commit, iter)
+	u.events.result("ConfigMap", u.name, commit.Hash.String(), u.changed, err)
+	return err
+}
+
+// Results returns objects written by the last Upload.
+func (u *configmapUploader) Results() []Result {
+	return u.results
+}
+
+func (u *configmapUploader) upload(commit *object.Commit, iter FileIter) error {
+	u.results = nil
+	u.changed = false
 
-	data, err := u.iterToConfigMapData(iter)
+	targets, err := u.iterToConfigMapData(commit, iter)
 	if err != nil {
 		return err
 	}
 
-	oldMap, err := configMaps.Get(context.TODO(), u.name, metav1.GetOptions{})
-	if err == nil {
-		err = u.patchConfigMap(oldMap, configMaps, data, commitID)
-		if err != nil {
-			return err
+	namespaces, err := u.namespaces.resolve(u.clientset, u.namespace)
+	if err != nil {
+		return err
+	}
+
+	// Failure in one namespace should not prevent updates of the others
+	var errs []error
+	for _, namespace := range namespaces {
+		if err := u.uploadConfigMaps(namespace, targets, commit); err != nil {
+			if u.namespaces != nil {
+				err = fmt.Errorf("namespace '%s': %w", namespace, err)
+			}
+			errs = append(errs, err)
 		}
-	} else {
-		err = u.createConfigMap(configMaps, data, commitID)
+	}
+	if err := u.pruneConfigMapNamespaces(namespaces); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// uploadConfigMaps creates or patches ConfigMaps in namespace.
+func (u *configmapUploader) uploadConfigMaps(namespace string, targets map[string]map[string]string, commit *object.Commit) error {
+	configMaps := u.clientset.CoreV1().ConfigMaps(namespace)
+	for _, name := range sortedTargets(targets) {
+		var current *corev1.ConfigMap
+		err := retryOnConflict("ConfigMap", namespace, name, func() error {
+			oldMap, err := configMaps.Get(context.TODO(), name, metav1.GetOptions{})
+			switch {
+			case err == nil:
+				current = oldMap
+				return u.patchConfigMap(oldMap, configMaps, targets[name], commit)
+			case k8serrors.IsNotFound(err):
+				return u.createConfigMap(configMaps, namespace, name, targets[name], commit)
+			default:
+				return newUploadError("get", "ConfigMap", namespace, name, err)
+			}
+		})
 		if err != nil {
+			if current != nil {
+				u.events.failed(current, commit.Hash.String(), err)
+			}
 			return err
 		}
 	}
 
+	if u.fanout != nil {
+		return u.pruneConfigMaps(configMaps, namespace, targets)
+	}
 	return nil
 }
 
-func (u *configmapUploader) patchConfigMap(oldMap *corev1.ConfigMap, configMaps typedcore.ConfigMapInterface, data map[string]string, commitID string) error {
+// pruneConfigMapNamespaces deletes ConfigMaps from namespaces that are no longer selected.
+func (u *configmapUploader) pruneConfigMapNamespaces(namespaces []string) error {
+	if u.namespaces == nil || !u.namespaces.prune {
+		return nil
+	}
+
+	list, err := u.clientset.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{LabelSelector: ownerSelector(u.labels[ownerLabel])})
+	if err != nil {
+		return newUploadError("list", "ConfigMap", metav1.NamespaceAll, ownerSelector(u.labels[ownerLabel]), err)
+	}
+
+	for _, configMap := range list.Items {
+		if !u.namespaces.stale(configMap.Namespace, namespaces) {
+			continue
+		}
+		log.Infof("Deleting ConfigMap '%s.%s' from no longer selected namespace", configMap.Namespace, configMap.Name)
+		err := u.clientset.CoreV1().ConfigMaps(configMap.Namespace).Delete(context.TODO(), configMap.Name, metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return newUploadError("delete", "ConfigMap", configMap.Namespace, configMap.Name, err)
+		}
+		u.changed = true
+	}
+
+	return nil
+}
+
+// pruneConfigMaps deletes ConfigMaps created by fanout whose directories no longer exist.
+func (u *configmapUploader) pruneConfigMaps(configMaps typedcore.ConfigMapInterface, namespace string, targets map[string]map[string]string) error {
+	list, err := configMaps.List(context.TODO(), metav1.ListOptions{LabelSelector: ownerSelector(u.labels[ownerLabel])})
+	if err != nil {
+		return newUploadError("list", "ConfigMap", namespace, ownerSelector(u.labels[ownerLabel]), err)
+	}
+
+	for _, configMap := range list.Items {
+		if _, exists := targets[configMap.Name]; exists {
+			continue
+		}
+		log.Infof("Deleting ConfigMap '%s.%s'", configMap.Namespace, configMap.Name)
+		err := configMaps.Delete(context.TODO(), configMap.Name, metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return newUploadError("delete", "ConfigMap", configMap.Namespace, configMap.Name, err)
+		}
+		u.changed = true
+	}
+
+	return nil
+}
+
+func (u *configmapUploader) patchConfigMap(oldMap *corev1.ConfigMap, configMaps typedcore.ConfigMapInterface, data map[string]string, commit *object.Commit) error {
 	log.Infof("Patching ConfigMap '%s.%s'", oldMap.Namespace, oldMap.Name)
 	newMap := oldMap.DeepCopy()
 
@@ -204,20 +446,19 @@ func (u *configmapUploader) patchConfigMap(oldMap *corev1.ConfigMap, configMaps
 				return err
 			}
 		}
+	case Owned:
+		newMap.Data = mergeOwned(newMap.Data, data, managedKeys(newMap.ObjectMeta))
 	}
 
-	if err := mergo.Merge(&newMap.Annotations, u.annotations, mergo.WithOverride); err != nil {
-		if err != nil {
-			return err
-		}
+	if err := applyMetadata(&newMap.ObjectMeta, u.labels, u.annotations); err != nil {
+		return err
 	}
-	newMap.Annotations[refAnnotation] = commitID
-
-	if err := mergo.Merge(&newMap.Labels, u.labels, mergo.WithOverride); err != nil {
-		if err != nil {
-			return err
-		}
+	if err := setManagedKeys(&newMap.ObjectMeta, sortedKeysOf(data)); err != nil {
+		return err
 	}
+	sum := checksum(data)
+	u.provenance.annotate(&newMap.ObjectMeta, commit, sum)
+	newMap.OwnerReferences = u.owner.apply(newMap.Namespace, newMap.OwnerReferences)
 
 	oldData, err := json.Marshal(oldMap)
 	if err != nil {
@@ -234,59 +475,121 @@ func (u *configmapUploader) patchConfigMap(oldMap *corev1.ConfigMap, configMaps
 		return err
 	}
 
-	_, err = configMaps.Patch(context.TODO(), u.name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{})
+	patchBytes, err = withResourceVersion(patchBytes, oldMap.ResourceVersion)
 	if err != nil {
 		return err
 	}
 
-	log.Infof("Successfully patched ConfigMap '%s.%s'", oldMap.Namespace, oldMap.Name)
+	result, err := configMaps.Patch(context.TODO(), oldMap.Name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{})
+	if err != nil {
+		return newUploadError("patch", "ConfigMap", oldMap.Namespace, oldMap.Name, err)
+	}
+	// Syncs of the same content are not recorded, watch would produce an event every interval
+	diff := diffKeys(oldMap.Data, newMap.Data, func(a, b string) bool { return a == b })
+	if !diff.empty() || !isSynced(oldMap.ObjectMeta, commit.Hash.String(), sum) {
+		u.changed = true
+		u.events.synced(result, commit.Hash.String(), diff)
+	}
+
+	u.results = append(u.results, newResult("ConfigMap", result.ObjectMeta, commit, sum))
+	log.Infof("Successfully patched ConfigMap '%s.%s' with checksum %s", oldMap.Namespace, oldMap.Name, sum)
 	return nil
 }
 
-func (u *configmapUploader) createConfigMap(configMaps typedcore.ConfigMapInterface, data map[string]string, commitID string) error {
-	log.Infof("Creating ConfigMap '%s.%s'", u.namespace, u.name)
+func (u *configmapUploader) createConfigMap(configMaps typedcore.ConfigMapInterface, namespace string, name string, data map[string]string, commit *object.Commit) error {
+	log.Infof("Creating ConfigMap '%s.%s'", namespace, name)
 
-	annotations := u.annotations
-	annotations[refAnnotation] = commitID
+	meta := metav1.ObjectMeta{
+		Name:            name,
+		Namespace:       namespace,
+		OwnerReferences: u.owner.apply(namespace, nil),
+	}
+	if err := applyMetadata(&meta, u.labels, u.annotations); err != nil {
+		return err
+	}
+	if err := setManagedKeys(&meta, sortedKeysOf(data)); err != nil {
+		return err
+	}
+	sum := checksum(data)
+	u.provenance.annotate(&meta, commit, sum)
 
-	_, err := configMaps.Create(
+	result, err := configMaps.Create(
 		context.TODO(),
 		&corev1.ConfigMap{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:        u.name,
-				Namespace:   u.namespace,
-				Annotations: annotations,
-				Labels:      u.labels,
-			},
-			Data: data,
+			ObjectMeta: meta,
+			Data:       data,
 		},
 		metav1.CreateOptions{},
 	)
 	if err != nil {
-		return err
+		return newUploadError("create", "ConfigMap", namespace, name, err)
 	}
+	u.changed = true
+	u.events.synced(result, commit.Hash.String(), diffKeys(nil, data, func(a, b string) bool { return a == b }))
 
-	log.Infof("Successfully created ConfigMap '%s.%s'", u.namespace, u.name)
+	u.results = append(u.results, newResult("ConfigMap", result.ObjectMeta, commit, sum))
+	log.Infof("Successfully created ConfigMap '%s.%s' with checksum %s", namespace, name, sum)
 	return nil
 }
 
-func (u *configmapUploader) iterToConfigMapData(iter FileIter) (map[string]string, error) {
-	data := make(map[string]string)
-	err := iter.ForEach(func(file *object.File) error {
-		if filterFile(file, u.includes, u.excludes) {
+// iterToConfigMapData returns data of the ConfigMaps indexed by their name.
+func (u *configmapUploader) iterToConfigMapData(commit *object.Commit, iter FileIter) (map[string]map[string]string, error) {
+	ignore, err := readIgnoreRules(u.ignoreFile, commitFiles(commit))
+	if err != nil {
+		return nil, err
+	}
+
+	targets := map[string]map[string]string{}
+	sources := make(map[string]keySources)
+	if u.fanout == nil {
+		targets[u.name] = make(map[string]string)
+	}
+	resolver := u.fanout.resolver()
+	err = iter.ForEach(func(file *object.File) error {
+		if filterFile(file, u.includes, u.excludes, ignore) {
+			file, err := transformFile(commit, file, u.transformers)
+			if err != nil {
+				return err
+			}
+			name, path, ok, err := resolver.target(u.name, file.Name)
+			if err != nil || !ok {
+				return err
+			}
+			key, err := u.keys.key(path)
+			if err != nil {
+				return err
+			}
+			if sources[name] == nil {
+				sources[name] = make(keySources)
+				targets[name] = make(map[string]string)
+			}
+			sources[name].add(key, file.Name)
+
 			content, err := file.Contents()
 			if err != nil {
 				return err
 			}
-			data[strings.ReplaceAll(file.Name, "/", ".")] = content
+			targets[name][key] = content
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	return data, err
+	for _, name := range sortedTargets(sources) {
+		if err := sources[name].collisions(); err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
 }
 
 func newSecretUploader(o UploaderOptions) (Uploader, error) {
+	if err := checkMergeType(o.MergeType); err != nil {
+		return nil, err
+	}
+
 	restconfig, err := restConfig(o.Kubeconfig)
 	if err != nil {
 		return nil, err
@@ -297,13 +600,13 @@ func newSecretUploader(o UploaderOptions) (Uploader, error) {
 		return nil, err
 	}
 
-	includesRegex, err := stringsToRegExp(o.Includes)
+	includesRegex, err := compileFilters(o.FilterSyntax, o.Includes)
 	if err != nil {
 		return nil, err
 	}
 	log.Infof("Loaded include rules %s", includesRegex)
 
-	excludesRegex, err := stringsToRegExp(o.Excludes)
+	excludesRegex, err := compileFilters(o.FilterSyntax, o.Excludes)
 	if err != nil {
 		return nil, err
 	}
@@ -319,44 +622,220 @@ func newSecretUploader(o UploaderOptions) (Uploader, error) {
 		return nil, err
 	}
 
+	keys, err := newKeyNamer(o.KeyStrategy, o.KeySeparator, o.KeyRenames)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := newFanout(o.SplitDepth, o.NameTemplate, o.Target)
+	if err != nil {
+		return nil, err
+	}
+	namespaces, err := newNamespaceSelector(o.Namespaces, o.NamespaceSelector, o.PruneNamespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	if targets != nil || namespaces != nil {
+		owner, err := ownerValue(o.Namespace, o.Target)
+		if err != nil {
+			return nil, err
+		}
+		labelsParsed[ownerLabel] = owner
+	}
+
+	ownerRef, err := newOwnerReference(clientset, o.OwnerReference, o.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if ownerRef != nil && namespaces != nil {
+		log.Warnf("Owner reference is set only on objects in namespace '%s', owner references can't cross namespaces", o.Namespace)
+	}
+
+	identities, err := loadAgeIdentities(o.AgeKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ageDecryptRegex, err := stringsToRegExp(o.AgeDecrypt)
+	if err != nil {
+		return nil, err
+	}
+
+	envsubstRegex, err := stringsToRegExp(o.Envsubst)
+	if err != nil {
+		return nil, err
+	}
+
+	templatesRegex, err := stringsToRegExp(o.Templates)
+	if err != nil {
+		return nil, err
+	}
+
+	renderer, err := newTemplateRenderer(templatesRegex, o.TemplateValues, o.TemplateEnvAllow)
+	if err != nil {
+		return nil, err
+	}
+
+	validateRegex, err := stringsToRegExp(o.Validate)
+	if err != nil {
+		return nil, err
+	}
+
+	validator, err := newValidator(validateRegex, o.ValidateSchemas)
+	if err != nil {
+		return nil, err
+	}
+
 	return &secretUploader{
 		mergeType:   o.MergeType,
 		includes:    includesRegex,
 		excludes:    excludesRegex,
+		ignoreFile:  o.IgnoreFile,
+		keys:        keys,
+		fanout:      targets,
+		namespaces:  namespaces,
+		owner:       ownerRef,
+		events:      newEventRecorder(clientset, o.Events),
+		provenance:  newProvenance(o.Repository, o.Branch),
 		labels:      labelsParsed,
 		annotations: annotationsParsed,
 		restconfig:  restconfig,
 		clientset:   clientset,
 		namespace:   o.Namespace,
 		name:        o.Target,
+		transformers: []transformer{
+			newAgeDecrypter(ageDecryptRegex, identities),
+			newSopsDecrypter(identities),
+			newEnvSubstituter(envsubstRegex, o.EnvsubstAllow),
+			renderer,
+			validator,
+		},
 	}, nil
 }
 
-func (u *secretUploader) Upload(commitID string, iter FileIter) error {
-	secrets := u.clientset.CoreV1().Secrets(u.namespace)
+func (u *secretUploader) Upload(commit *object.Commit, iter FileIter) error {
+	err := u.upload(commit, iter)
+	u.events.result("Secret", u.name, commit.Hash.String(), u.changed, err)
+	return err
+}
+
+// Results returns objects written by the last Upload.
+func (u *secretUploader) Results() []Result {
+	return u.results
+}
+
+func (u *secretUploader) upload(commit *object.Commit, iter FileIter) error {
+	u.results = nil
+	u.changed = false
 
-	data, err := u.iterToSecretData(iter)
+	targets, err := u.iterToSecretData(commit, iter)
 	if err != nil {
 		return err
 	}
 
-	oldSecret, err := secrets.Get(context.TODO(), u.name, metav1.GetOptions{})
-	if err == nil {
-		err = u.patchSecret(oldSecret, secrets, data, commitID)
-		if err != nil {
-			return err
+	namespaces, err := u.namespaces.resolve(u.clientset, u.namespace)
+	if err != nil {
+		return err
+	}
+
+	// Failure in one namespace should not prevent updates of the others
+	var errs []error
+	for _, namespace := range namespaces {
+		if err := u.uploadSecrets(namespace, targets, commit); err != nil {
+			if u.namespaces != nil {
+				err = fmt.Errorf("namespace '%s': %w", namespace, err)
+			}
+			errs = append(errs, err)
 		}
-	} else {
-		err = u.createSecret(secrets, data, commitID)
+	}
+	if err := u.pruneSecretNamespaces(namespaces); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// uploadSecrets creates or patches Secrets in namespace.
+func (u *secretUploader) uploadSecrets(namespace string, targets map[string]map[string][]byte, commit *object.Commit) error {
+	secrets := u.clientset.CoreV1().Secrets(namespace)
+	for _, name := range sortedTargets(targets) {
+		var current *corev1.Secret
+		err := retryOnConflict("Secret", namespace, name, func() error {
+			oldSecret, err := secrets.Get(context.TODO(), name, metav1.GetOptions{})
+			switch {
+			case err == nil:
+				current = oldSecret
+				return u.patchSecret(oldSecret, secrets, targets[name], commit)
+			case k8serrors.IsNotFound(err):
+				return u.createSecret(secrets, namespace, name, targets[name], commit)
+			default:
+				return newUploadError("get", "Secret", namespace, name, err)
+			}
+		})
 		if err != nil {
+			if current != nil {
+				u.events.failed(current, commit.Hash.String(), err)
+			}
 			return err
 		}
 	}
 
+	if u.fanout != nil {
+		return u.pruneSecrets(secrets, namespace, targets)
+	}
 	return nil
 }
 
-func (u *secretUploader) patchSecret(oldSecret *corev1.Secret, secrets typedcore.SecretInterface, data map[string][]byte, commitID string) error {
+// pruneSecretNamespaces deletes Secrets from namespaces that are no longer selected.
+func (u *secretUploader) pruneSecretNamespaces(namespaces []string) error {
+	if u.namespaces == nil || !u.namespaces.prune {
+		return nil
+	}
+
+	list, err := u.clientset.CoreV1().Secrets(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{LabelSelector: ownerSelector(u.labels[ownerLabel])})
+	if err != nil {
+		return newUploadError("list", "Secret", metav1.NamespaceAll, ownerSelector(u.labels[ownerLabel]), err)
+	}
+
+	for _, secret := range list.Items {
+		if !u.namespaces.stale(secret.Namespace, namespaces) {
+			continue
+		}
+		log.Infof("Deleting Secret '%s.%s' from no longer selected namespace", secret.Namespace, secret.Name)
+		err := u.clientset.CoreV1().Secrets(secret.Namespace).Delete(context.TODO(), secret.Name, metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return newUploadError("delete", "Secret", secret.Namespace, secret.Name, err)
+		}
+		u.changed = true
+	}
+
+	return nil
+}
+
+// pruneSecrets deletes Secrets created by fanout whose directories no longer exist.
+func (u *secretUploader) pruneSecrets(secrets typedcore.SecretInterface, namespace string, targets map[string]map[string][]byte) error {
+	list, err := secrets.List(context.TODO(), metav1.ListOptions{LabelSelector: ownerSelector(u.labels[ownerLabel])})
+	if err != nil {
+		return newUploadError("list", "Secret", namespace, ownerSelector(u.labels[ownerLabel]), err)
+	}
+
+	for _, secret := range list.Items {
+		if _, exists := targets[secret.Name]; exists {
+			continue
+		}
+		log.Infof("Deleting Secret '%s.%s'", secret.Namespace, secret.Name)
+		err := secrets.Delete(context.TODO(), secret.Name, metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return newUploadError("delete", "Secret", secret.Namespace, secret.Name, err)
+		}
+		u.changed = true
+	}
+
+	return nil
+}
+
+func (u *secretUploader) patchSecret(oldSecret *corev1.Secret, secrets typedcore.SecretInterface, data map[string][]byte, commit *object.Commit) error {
 	log.Infof("Patching Secret '%s.%s'", oldSecret.Namespace, oldSecret.Name)
 	newSecret := oldSecret.DeepCopy()
 
@@ -369,20 +848,19 @@ func (u *secretUploader) patchSecret(oldSecret *corev1.Secret, secrets typedcore
 				return err
 			}
 		}
+	case Owned:
+		newSecret.Data = mergeOwned(newSecret.Data, data, managedKeys(newSecret.ObjectMeta))
 	}
 
-	if err := mergo.Merge(&newSecret.Annotations, u.annotations, mergo.WithOverride); err != nil {
-		if err != nil {
-			return err
-		}
+	if err := applyMetadata(&newSecret.ObjectMeta, u.labels, u.annotations); err != nil {
+		return err
 	}
-	newSecret.Annotations[refAnnotation] = commitID
-
-	if err := mergo.Merge(&newSecret.Labels, u.labels, mergo.WithOverride); err != nil {
-		if err != nil {
-			return err
-		}
+	if err := setManagedKeys(&newSecret.ObjectMeta, sortedKeysOf(data)); err != nil {
+		return err
 	}
+	sum := checksum(data)
+	u.provenance.annotate(&newSecret.ObjectMeta, commit, sum)
+	newSecret.OwnerReferences = u.owner.apply(newSecret.Namespace, newSecret.OwnerReferences)
 
 	oldData, err := json.Marshal(oldSecret)
 	if err != nil {
@@ -399,153 +877,159 @@ func (u *secretUploader) patchSecret(oldSecret *corev1.Secret, secrets typedcore
 		return err
 	}
 
-	_, err = secrets.Patch(context.TODO(), u.name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{})
+	patchBytes, err = withResourceVersion(patchBytes, oldSecret.ResourceVersion)
 	if err != nil {
 		return err
 	}
 
-	log.Infof("Successfully patched ConfigMap '%s.%s'", oldSecret.Namespace, oldSecret.Name)
+	result, err := secrets.Patch(context.TODO(), oldSecret.Name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{})
+	if err != nil {
+		return newUploadError("patch", "Secret", oldSecret.Namespace, oldSecret.Name, err)
+	}
+	// Syncs of the same content are not recorded, watch would produce an event every interval
+	diff := diffKeys(oldSecret.Data, newSecret.Data, bytes.Equal)
+	if !diff.empty() || !isSynced(oldSecret.ObjectMeta, commit.Hash.String(), sum) {
+		u.changed = true
+		u.events.synced(result, commit.Hash.String(), diff)
+	}
+
+	u.results = append(u.results, newResult("Secret", result.ObjectMeta, commit, sum))
+	log.Infof("Successfully patched Secret '%s.%s' with checksum %s", oldSecret.Namespace, oldSecret.Name, sum)
 	return nil
 }
 
-func (u *secretUploader) createSecret(secrets typedcore.SecretInterface, data map[string][]byte, commitID string) error {
-	log.Infof("Creating ConfigMap '%s.%s'", u.namespace, u.name)
+func (u *secretUploader) createSecret(secrets typedcore.SecretInterface, namespace string, name string, data map[string][]byte, commit *object.Commit) error {
+	log.Infof("Creating Secret '%s.%s'", namespace, name)
 
-	annotations := u.annotations
-	annotations[refAnnotation] = commitID
+	meta := metav1.ObjectMeta{
+		Name:            name,
+		Namespace:       namespace,
+		OwnerReferences: u.owner.apply(namespace, nil),
+	}
+	if err := applyMetadata(&meta, u.labels, u.annotations); err != nil {
+		return err
+	}
+	if err := setManagedKeys(&meta, sortedKeysOf(data)); err != nil {
+		return err
+	}
+	sum := checksum(data)
+	u.provenance.annotate(&meta, commit, sum)
 
-	_, err := secrets.Create(
+	result, err := secrets.Create(
 		context.TODO(),
 		&corev1.Secret{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:        u.name,
-				Namespace:   u.namespace,
-				Annotations: annotations,
-				Labels:      u.labels,
-			},
-			Data: data,
+			ObjectMeta: meta,
+			Data:       data,
 		},
 		metav1.CreateOptions{},
 	)
 	if err != nil {
-		return err
+		return newUploadError("create", "Secret", namespace, name, err)
 	}
+	u.changed = true
+	u.events.synced(result, commit.Hash.String(), diffKeys(nil, data, bytes.Equal))
 
-	log.Infof("Successfully created ConfigMap '%s.%s'", u.namespace, u.name)
+	u.results = append(u.results, newResult("Secret", result.ObjectMeta, commit, sum))
+	log.Infof("Successfully created Secret '%s.%s' with checksum %s", namespace, name, sum)
 	return nil
 }
 
-func (u *secretUploader) iterToSecretData(iter FileIter) (map[string][]byte, error) {
-	data := make(map[string][]byte)
-	err := iter.ForEach(func(file *object.File) error {
-		if filterFile(file, u.includes, u.excludes) {
-			content, err := file.Contents()
-			if err != nil {
-				return err
-			}
-			data[strings.ReplaceAll(file.Name, "/", ".")] = []byte(content)
-		}
-		return nil
-	})
-
-	return data, err
-}
-
-func newFolderUploader(o UploaderOptions) (Uploader, error) {
-	err := os.RemoveAll(o.Target)
-	if err != nil {
-		return nil, err
-	}
-	err = os.MkdirAll(o.Target, os.ModePerm) // #nosec G301
-	if err != nil {
-		return nil, err
-	}
-	log.Infof("Created empty folder %s", o.Target)
-
-	includesRegex, err := stringsToRegExp(o.Includes)
+// iterToSecretData returns data of the Secrets indexed by their name.
+func (u *secretUploader) iterToSecretData(commit *object.Commit, iter FileIter) (map[string]map[string][]byte, error) {
+	ignore, err := readIgnoreRules(u.ignoreFile, commitFiles(commit))
 	if err != nil {
 		return nil, err
 	}
-	log.Infof("Loaded include rules %s", includesRegex)
 
-	excludesRegex, err := stringsToRegExp(o.Excludes)
-	if err != nil {
-		return nil, err
+	targets := map[string]map[string][]byte{}
+	sources := make(map[string]keySources)
+	if u.fanout == nil {
+		targets[u.name] = make(map[string][]byte)
 	}
-	log.Infof("Loaded exclude rules %s", excludesRegex)
-
-	return &folderUploader{
-		includes:   includesRegex,
-		excludes:   excludesRegex,
-		name:       o.Target,
-		sourcePath: o.Source,
-	}, nil
-}
-
-func (u *folderUploader) Upload(commitID string, iter FileIter) error {
-	filesToKeep := make(map[string]bool)
-	err := iter.ForEach(func(file *object.File) error {
-		if filterFile(file, u.includes, u.excludes) {
-			src := path.Join(u.sourcePath, file.Name)
-			if _, err := os.Lstat(src); err == nil {
-				src, _ = filepath.Abs(src) // #nosec G104
+	resolver := u.fanout.resolver()
+	err = iter.ForEach(func(file *object.File) error {
+		if filterFile(file, u.includes, u.excludes, ignore) {
+			file, err := transformFile(commit, file, u.transformers)
+			if err != nil {
+				return err
 			}
-			dst := path.Join(u.name, file.Name)
-			filesToKeep[dst] = true
-
-			source, err := os.Open(src) // #nosec G304
+			name, path, ok, err := resolver.target(u.name, file.Name)
+			if err != nil || !ok {
+				return err
+			}
+			key, err := u.keys.key(path)
 			if err != nil {
 				return err
 			}
-			defer source.Close()
-
-			if dir, _ := filepath.Split(dst); dir != "" {
-				err = os.MkdirAll(dir, 0o777) // #nosec G301
-				if err != nil {
-					return err
-				}
+			if sources[name] == nil {
+				sources[name] = make(keySources)
+				targets[name] = make(map[string][]byte)
 			}
+			sources[name].add(key, file.Name)
 
-			destination, err := os.Create(dst) // #nosec G304
+			content, err := file.Contents()
 			if err != nil {
 				return err
 			}
-			defer destination.Close()
-
-			buf := make([]byte, bufferSize)
-			for {
-				n, err := source.Read(buf)
-				if err != nil && err != io.EOF {
-					return err
-				}
-				if n == 0 {
-					break
-				}
-				if _, err := destination.Write(buf[:n]); err != nil {
-					return err
-				}
-			}
+			targets[name][key] = []byte(content)
 		}
 		return nil
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = filepath.Walk(u.name, func(path string, info os.FileInfo, err error) error {
-		if _, exists := filesToKeep[path]; info != nil && !info.IsDir() && !exists {
-			err := os.Remove(path)
-			if err != nil {
-				return err
-			}
+	for _, name := range sortedTargets(sources) {
+		if err := sources[name].collisions(); err != nil {
+			return nil, err
 		}
-		return nil
-	})
+	}
+	return targets, nil
+}
 
+// retryOnConflict retries fn that re-reads the object and patches it when the patch fails due to concurrent modification.
+func retryOnConflict(kind string, namespace string, name string, fn func() error) error {
+	conflicts := 0
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := fn()
+		if k8serrors.IsConflict(err) {
+			conflicts++
+			log.Warnf("%s '%s.%s' was modified concurrently, retrying (conflicts: %d)", kind, namespace, name, conflicts)
+		}
+		return err
+	})
+	if k8serrors.IsConflict(err) {
+		return fmt.Errorf("giving up on %s '%s.%s' after %d conflicts: %w", kind, namespace, name, conflicts, err)
+	}
+	if err == nil && conflicts > 0 {
+		log.Infof("Updated %s '%s.%s' after %d conflicts", kind, namespace, name, conflicts)
+	}
 	return err
 }
 
-func filterFile(file *object.File, includes []*regexp.Regexp, excludes []*regexp.Regexp) bool {
+// withResourceVersion adds resourceVersion precondition to the patch so that it fails with conflict
+// if the object changed since it was read.
+func withResourceVersion(patch []byte, resourceVersion string) ([]byte, error) {
+	if resourceVersion == "" {
+		return patch, nil
+	}
+
+	parsed := make(map[string]interface{})
+	if err := json.Unmarshal(patch, &parsed); err != nil {
+		return nil, err
+	}
+	metadata, ok := parsed["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = make(map[string]interface{})
+		parsed["metadata"] = metadata
+	}
+	metadata["resourceVersion"] = resourceVersion
+
+	return json.Marshal(parsed)
+}
+
+// filterFile returns true if the file matches includes and neither excludes nor ignore rules match it.
+func filterFile(file *object.File, includes []*regexp.Regexp, excludes []*regexp.Regexp, ignore ignoreRules) bool {
 	pass := false
 	for _, inc := range includes {
 		if inc.MatchString(file.Name) {
@@ -561,10 +1045,23 @@ func filterFile(file *object.File, includes []*regexp.Regexp, excludes []*regexp
 		}
 	}
 
+	if pass && ignore.ignored(file.Name) {
+		pass = false
+	}
+
 	log.Debugf("[%t] '%s'", pass, file.Name)
 	return pass
 }
 
+func matchesAny(name string, patterns []*regexp.Regexp) bool {
+	for _, p := range patterns {
+		if p.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
 func restConfig(kubeconfig bool) (*rest.Config, error) {
 	if kubeconfig {
 		log.Infof("Loading kubeconfig")
@@ -607,4 +1104,5 @@ func init() {
 	register(ConfigMap, newConfigMapUploader)
 	register(Secret, newSecretUploader)
 	register(Folder, newFolderUploader)
+	register(Manifests, newManifestsUploader)
 }
@@ -2,20 +2,39 @@ package upload
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"maps"
 	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	testclient "k8s.io/client-go/kubernetes/fake"
 	testing2 "k8s.io/client-go/testing"
 )
 
+var testCommit = &object.Commit{
+	Hash: plumbing.NewHash("0123456789abcdef0123456789abcdef01234567"),
+	Author: object.Signature{
+		Name:  "Test",
+		Email: "test@example.com",
+		When:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	},
+	Message: "Test commit",
+}
+
 type mockFileIter struct {
 	files []*object.File
 }
@@ -35,7 +54,9 @@ func (m *mockFileIter) ForEach(cb func(*object.File) error) error {
 			panic(err)
 		}
 
-		cb(object.NewFile(f.Name, f.Mode, blob))
+		if err := cb(object.NewFile(f.Name, f.Mode, blob)); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -150,7 +171,7 @@ func TestConfigmapUploader_Upload(t *testing.T) {
 			includes:    c.includes,
 			excludes:    c.excludes,
 		}
-		err := cu.Upload("id", c.iter)
+		err := cu.Upload(testCommit, c.iter)
 		if err != nil {
 			t.Errorf("%s case failed: %v", c.name, err)
 		}
@@ -178,7 +199,7 @@ func TestSecretUploader_Upload(t *testing.T) {
 			includes:    c.includes,
 			excludes:    c.excludes,
 		}
-		err := cu.Upload("id", c.iter)
+		err := cu.Upload(testCommit, c.iter)
 		if err != nil {
 			t.Errorf("%s case failed: %v", c.name, err)
 		}
@@ -201,20 +222,13 @@ func TestSecretUploader_Upload(t *testing.T) {
 }
 
 func TestFolderUploader_Upload(t *testing.T) {
-	ex, err := os.Executable()
-	if err != nil {
-		panic(err)
-	}
-	exPath := filepath.Dir(ex)
-
 	for _, c := range basicCases {
 		cu := &folderUploader{
-			sourcePath: exPath,
-			name:       c.target,
-			includes:   c.includes,
-			excludes:   c.excludes,
+			name:     filepath.Join(t.TempDir(), c.target),
+			includes: c.includes,
+			excludes: c.excludes,
 		}
-		err := cu.Upload("id", c.iter)
+		err := cu.Upload(testCommit, c.iter)
 		if err != nil {
 			t.Errorf("%s case failed: %v", c.name, err)
 		}
@@ -231,6 +245,20 @@ func assertAction(action testing2.Action, t *testing.T, name string, namespace s
 }
 
 func assertAnnotationsAndLabels(annotations map[string]string, labels map[string]string, t *testing.T, name string, exannotations map[string]string, exlabels map[string]string) {
+	if annotations[refAnnotation] != testCommit.Hash.String() {
+		t.Errorf("%s case failed: expected '%s' annotation with commit but got '%s' instead", name, refAnnotation, annotations[refAnnotation])
+	}
+	for _, a := range []string{managedMetadataAnnotation, managedKeysAnnotation, checksumAnnotation, authorAnnotation, commitTimeAnnotation, syncTimeAnnotation} {
+		if _, ok := annotations[a]; !ok {
+			t.Errorf("%s case failed: expected '%s' annotation", name, a)
+		}
+	}
+
+	// Compare only configured annotations
+	annotations = maps.Clone(annotations)
+	for _, a := range []string{refAnnotation, managedMetadataAnnotation, managedKeysAnnotation, checksumAnnotation, authorAnnotation, commitTimeAnnotation, syncTimeAnnotation} {
+		delete(annotations, a)
+	}
 	if !reflect.DeepEqual(annotations, exannotations) {
 		t.Errorf("%s case failed: expected annotations '%s' but got '%s' instead", name, exannotations, annotations)
 	}
@@ -256,3 +284,59 @@ func assertData(data map[string]string, t *testing.T, name string, contains []st
 		}
 	}
 }
+
+func TestConfigmapUploader_UploadConflict(t *testing.T) {
+	cases := []struct {
+		name      string
+		conflicts int
+		fail      bool
+	}{
+		{name: "No conflict"},
+		{name: "Resolved conflicts", conflicts: 2},
+		{name: "Unresolved conflicts", conflicts: 10, fail: true},
+	}
+
+	for _, c := range cases {
+		existing := &corev1.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: "git2kube", Namespace: "default", ResourceVersion: "42", Annotations: map[string]string{}}}
+		fakeclient := testclient.NewSimpleClientset(existing)
+		patches := 0
+		fakeclient.PrependReactor("patch", "configmaps", func(action testing2.Action) (bool, runtime.Object, error) {
+			patches++
+			patch := make(map[string]interface{})
+			if err := json.Unmarshal(action.(testing2.PatchAction).GetPatch(), &patch); err != nil {
+				return true, nil, err
+			}
+			if patch["metadata"].(map[string]interface{})["resourceVersion"] != "42" {
+				t.Errorf("%s case failed: patch is missing resourceVersion: %v", c.name, patch)
+			}
+			if patches <= c.conflicts {
+				return true, nil, k8serrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "git2kube", errors.New("modified"))
+			}
+			return false, nil, nil
+		})
+
+		cu := &configmapUploader{
+			clientset:   fakeclient,
+			namespace:   "default",
+			name:        "git2kube",
+			labels:      map[string]string{},
+			annotations: map[string]string{},
+			mergeType:   Delete,
+		}
+		err := cu.Upload(testCommit, &mockFileIter{})
+		if c.fail != (err != nil) {
+			t.Errorf("%s case failed: unexpected result %v", c.name, err)
+		}
+		if !c.fail && patches != c.conflicts+1 {
+			t.Errorf("%s case failed: expected %d patches but got %d instead", c.name, c.conflicts+1, patches)
+		}
+	}
+}
+
+func TestNewUploader_InvalidMergeType(t *testing.T) {
+	for _, factory := range []UploaderFactory{newConfigMapUploader, newSecretUploader} {
+		if _, err := factory(UploaderOptions{MergeType: "own"}); err == nil || !strings.Contains(err.Error(), "invalid merge type 'own'") {
+			t.Errorf("expected invalid merge type error but got %v instead", err)
+		}
+	}
+}
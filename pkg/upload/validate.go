@@ -0,0 +1,342 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	sigsyaml "sigs.k8s.io/yaml"
+	yamlv2 "sigs.k8s.io/yaml/goyaml.v2"
+)
+
+// schemaScheme URL scheme of JSON Schemas loaded from the synced commit.
+const schemaScheme = "git"
+
+// validator checks syntax of YAML, JSON and TOML files matching patterns and validates them against JSON Schemas
+// stored in the repository, invalid file aborts the sync so that the previous version is kept in target.
+type validator struct {
+	patterns []*regexp.Regexp
+	schemas  []schemaRule
+	revision string
+	compiled map[string]*jsonschema.Schema
+}
+
+// fileSource reads files by their path in the repository.
+type fileSource func(path string) ([]byte, error)
+
+// commitFiles reads files from the commit.
+func commitFiles(commit *object.Commit) fileSource {
+	return func(filePath string) ([]byte, error) {
+		file, err := commit.File(filePath)
+		if err != nil {
+			return nil, err
+		}
+		content, err := file.Contents()
+		return []byte(content), err
+	}
+}
+
+// folderFiles reads files from the local working copy.
+func folderFiles(folder string) fileSource {
+	return func(filePath string) ([]byte, error) {
+		if !isLocalPath(filePath) {
+			return nil, fmt.Errorf("path '%s' escapes folder", filePath)
+		}
+		return os.ReadFile(filepath.Join(folder, filepath.FromSlash(filePath))) // #nosec G304
+	}
+}
+
+// schemaRule JSON Schema in the repository files matching pattern are validated against.
+type schemaRule struct {
+	pattern *regexp.Regexp
+	path    string
+}
+
+// newValidator creates validator of files matching patterns, schemas are rules in format REGEX=PATH
+// where PATH is location of the JSON Schema in the repository.
+func newValidator(patterns []*regexp.Regexp, schemas []string) (*validator, error) {
+	rules := make([]schemaRule, len(schemas))
+	for i, s := range schemas {
+		expr, schemaPath, ok := strings.Cut(s, "=")
+		if !ok || schemaPath == "" {
+			return nil, fmt.Errorf("schema rule '%s' does not match required format REGEX=PATH", s)
+		}
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		rules[i] = schemaRule{pattern: regex, path: path.Clean(strings.TrimPrefix(schemaPath, "/"))}
+	}
+
+	return &validator{
+		patterns: patterns,
+		schemas:  rules,
+	}, nil
+}
+
+func (v *validator) transform(commit *object.Commit, file *object.File) (*object.File, error) {
+	if err := v.validate(commit.Hash.String(), commitFiles(commit), file); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// validate returns error describing the first problem found in the file, schemas are read from source
+// and cached until revision changes.
+func (v *validator) validate(revision string, source fileSource, file *object.File) error {
+	var rules []schemaRule
+	for _, rule := range v.schemas {
+		if rule.pattern.MatchString(file.Name) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 && !matchesAny(file.Name, v.patterns) {
+		return nil
+	}
+
+	content, err := file.Contents()
+	if err != nil {
+		return err
+	}
+
+	docs, err := parseDocuments(file.Name, []byte(content))
+	if err != nil {
+		return err
+	}
+	if docs == nil {
+		if len(rules) > 0 {
+			return fmt.Errorf("file '%s' can't be validated against schema, only YAML, JSON and TOML files are supported", file.Name)
+		}
+		log.Debugf("Skipping validation of '%s', not a YAML, JSON or TOML file", file.Name)
+		return nil
+	}
+
+	for _, rule := range rules {
+		schema, err := v.schema(revision, source, rule.path)
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if err := doc.validate(schema); err != nil {
+				return fmt.Errorf("file '%s' does not match schema '%s' %w", file.Name, rule.path, err)
+			}
+		}
+	}
+	log.Debugf("Validated '%s'", file.Name)
+	return nil
+}
+
+// schema returns compiled JSON Schema read from source, schemas are cached until the revision changes.
+func (v *validator) schema(revision string, source fileSource, schemaPath string) (*jsonschema.Schema, error) {
+	if v.revision != revision || v.compiled == nil {
+		v.revision = revision
+		v.compiled = make(map[string]*jsonschema.Schema)
+	}
+	if schema, ok := v.compiled[schemaPath]; ok {
+		return schema, nil
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.UseLoader(schemaLoader{source: source})
+	schema, err := compiler.Compile(schemaScheme + ":///" + schemaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema '%s': %w", schemaPath, err)
+	}
+	v.compiled[schemaPath] = schema
+	return schema, nil
+}
+
+// schemaLoader loads JSON or YAML schemas referenced by git:///PATH URLs from the source.
+type schemaLoader struct {
+	source fileSource
+}
+
+func (l schemaLoader) Load(url string) (any, error) {
+	schemaPath, ok := strings.CutPrefix(url, schemaScheme+":///")
+	if !ok {
+		return nil, fmt.Errorf("schema '%s' is not stored in the repository", url)
+	}
+
+	content, err := l.source(schemaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema '%s': %w", schemaPath, err)
+	}
+
+	data, err := sigsyaml.YAMLToJSON(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema '%s': %w", schemaPath, err)
+	}
+	return jsonschema.UnmarshalJSON(bytes.NewReader(data))
+}
+
+// document parsed content of a file, node is used to find lines of schema violations if available.
+type document struct {
+	value any
+	node  *yaml.Node
+}
+
+// parseDocuments parses the file based on its extension, nil is returned for unsupported extensions.
+func parseDocuments(name string, content []byte) ([]document, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".yaml", ".yml":
+		return parseYAML(name, content)
+	case ".json":
+		return parseJSON(name, content)
+	case ".toml":
+		return parseTOML(name, content)
+	default:
+		return nil, nil
+	}
+}
+
+// parseYAML parses all documents of the YAML file.
+func parseYAML(name string, content []byte) ([]document, error) {
+	// yaml.v2 reports more accurate lines of syntax errors than yaml.v3
+	syntax := yamlv2.NewDecoder(bytes.NewReader(content))
+	for {
+		var value any
+		err := syntax.Decode(&value)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid YAML file '%s': %w", name, err)
+		}
+	}
+
+	docs := []document{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		node := &yaml.Node{}
+		err := decoder.Decode(node)
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid YAML file '%s': %w", name, err)
+		}
+
+		var value any
+		if err := node.Decode(&value); err != nil {
+			return nil, fmt.Errorf("invalid YAML file '%s': %w", name, err)
+		}
+		docs = append(docs, document{value: value, node: node})
+	}
+}
+
+// parseJSON parses the JSON file, lines are reported for syntax errors.
+func parseJSON(name string, content []byte) ([]document, error) {
+	value, err := jsonschema.UnmarshalJSON(bytes.NewReader(content))
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, fmt.Errorf("invalid JSON file '%s' at line %d: %w", name, lineOf(content, syntaxErr.Offset), err)
+		}
+		return nil, fmt.Errorf("invalid JSON file '%s': %w", name, err)
+	}
+
+	// JSON is valid YAML, the node is used only to locate schema violations
+	doc := document{value: value}
+	node := &yaml.Node{}
+	if yaml.Unmarshal(content, node) == nil {
+		doc.node = node
+	}
+	return []document{doc}, nil
+}
+
+// parseTOML parses the TOML file.
+func parseTOML(name string, content []byte) ([]document, error) {
+	var value map[string]any
+	if err := toml.Unmarshal(content, &value); err != nil {
+		return nil, fmt.Errorf("invalid TOML file '%s': %w", name, err)
+	}
+	return []document{{value: value}}, nil
+}
+
+// normalize converts decoded value into JSON data model expected by schema validation.
+func normalize(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return jsonschema.UnmarshalJSON(bytes.NewReader(data))
+}
+
+// validate returns error describing the first schema violation with its location.
+func (d document) validate(schema *jsonschema.Schema) error {
+	value, err := normalize(d.value)
+	if err != nil {
+		return fmt.Errorf("can't be converted to JSON: %w", err)
+	}
+
+	err = schema.Validate(value)
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+
+	// Report the most specific cause
+	for len(validationErr.Causes) > 0 {
+		validationErr = validationErr.Causes[0]
+	}
+	location := "/" + strings.Join(validationErr.InstanceLocation, "/")
+	message := validationErr.BasicOutput().Error.String()
+	if line := d.line(validationErr.InstanceLocation); line > 0 {
+		return fmt.Errorf("at line %d ('%s'): %s", line, location, message)
+	}
+	return fmt.Errorf("at '%s': %s", location, message)
+}
+
+// line returns line of the value at location, 0 is returned if it is unknown.
+func (d document) line(location []string) int {
+	node := d.node
+	if node == nil {
+		return 0
+	}
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for _, token := range location {
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == token {
+					next = node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(node.Content) {
+				next = node.Content[i]
+			}
+		}
+		if next == nil {
+			return node.Line
+		}
+		node = next
+	}
+	return node.Line
+}
+
+// lineOf returns line number of the offset in content.
+func lineOf(content []byte, offset int64) int {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	return bytes.Count(content[:offset], []byte("\n")) + 1
+}
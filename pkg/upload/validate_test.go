@@ -0,0 +1,234 @@
+package upload
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+const appSchema = `
+type: object
+required: [name]
+properties:
+  name:
+    type: string
+  replicas:
+    $ref: replicas.json
+`
+
+// commitOf commits files into in-memory repository and returns the commit.
+func commitOf(t *testing.T, files map[string]string) *object.Commit {
+	fs := memfs.New()
+	repo, err := git.Init(memory.NewStorage(), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := util.WriteFile(fs, name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := worktree.Add(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hash, err := worktree.Commit("Test commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "Test", Email: "test@example.com", When: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commit
+}
+
+func TestValidator_Validate(t *testing.T) {
+	commit := commitOf(t, map[string]string{
+		"schemas/app.yaml":      appSchema,
+		"schemas/replicas.json": `{"type": "integer", "minimum": 1}`,
+	})
+
+	cases := []struct {
+		name     string
+		file     string
+		content  string
+		schemas  []string
+		expected string
+	}{
+		{
+			name:    "Valid multi-document YAML",
+			file:    "test.yaml",
+			content: "a: 1\n---\nb: [1, 2]\n",
+		},
+		{
+			name:     "Invalid YAML",
+			file:     "test.yml",
+			content:  "a: 1\nb: [1, 2\n",
+			expected: "invalid YAML file 'test.yml': yaml: line 2",
+		},
+		{
+			name:    "YAML with non-string keys",
+			file:    "test.yaml",
+			content: "1: a\n2: b\n",
+		},
+		{
+			name:    "Valid JSON",
+			file:    "test.json",
+			content: `{"a": [1, 2]}`,
+		},
+		{
+			name:     "Invalid JSON",
+			file:     "test.json",
+			content:  "{\n  \"a\": 1,\n  \"b\": }\n",
+			expected: "invalid JSON file 'test.json' at line 3",
+		},
+		{
+			name:     "Trailing JSON",
+			file:     "test.json",
+			content:  "{}\n{}\n",
+			expected: "invalid JSON file 'test.json'",
+		},
+		{
+			name:    "Valid TOML",
+			file:    "test.toml",
+			content: "[server]\nport = 8080\n",
+		},
+		{
+			name:     "Invalid TOML",
+			file:     "test.toml",
+			content:  "[server]\nport = \n",
+			expected: "invalid TOML file 'test.toml': toml: line 2",
+		},
+		{
+			name:    "Unsupported extension",
+			file:    "test.conf",
+			content: "a: [",
+		},
+		{
+			name:    "Not matching file",
+			file:    "skip/test.yaml",
+			content: "a: [",
+		},
+		{
+			name:    "Valid schema",
+			file:    "apps/app.yaml",
+			content: "name: app\nreplicas: 2\n",
+			schemas: []string{`^apps/=schemas/app.yaml`},
+		},
+		{
+			name:     "Invalid schema reference",
+			file:     "apps/app.yaml",
+			content:  "name: app\nreplicas: 0\n",
+			schemas:  []string{`^apps/=schemas/app.yaml`},
+			expected: "file 'apps/app.yaml' does not match schema 'schemas/app.yaml' at line 2 ('/replicas'): minimum: got 0, want 1",
+		},
+		{
+			name:     "Invalid schema JSON",
+			file:     "apps/app.json",
+			content:  "{\n  \"replicas\": 1\n}",
+			schemas:  []string{`^apps/=schemas/app.yaml`},
+			expected: "file 'apps/app.json' does not match schema 'schemas/app.yaml' at line 1 ('/'): missing property 'name'",
+		},
+		{
+			name:     "Invalid schema TOML",
+			file:     "apps/app.toml",
+			content:  "name = 1\n",
+			schemas:  []string{`^apps/=schemas/app.yaml`},
+			expected: "file 'apps/app.toml' does not match schema 'schemas/app.yaml' at '/name': got number, want string",
+		},
+		{
+			name:     "Missing schema",
+			file:     "apps/app.yaml",
+			content:  "name: app\n",
+			schemas:  []string{`^apps/=schemas/missing.json`},
+			expected: "failed to compile schema 'schemas/missing.json'",
+		},
+		{
+			name:     "Schema of unsupported file",
+			file:     "apps/app.conf",
+			content:  "name: app\n",
+			schemas:  []string{`^apps/=schemas/app.yaml`},
+			expected: "file 'apps/app.conf' can't be validated against schema",
+		},
+	}
+
+	for _, c := range cases {
+		v, err := newValidator([]*regexp.Regexp{regexp.MustCompile(`^[^/]*$`)}, c.schemas)
+		if err != nil {
+			t.Fatalf("%s case failed: %v", c.name, err)
+		}
+		file, err := newMemoryFile(c.file, filemode.Regular, []byte(c.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = v.validate(commit.Hash.String(), commitFiles(commit), file)
+		switch {
+		case c.expected == "" && err != nil:
+			t.Errorf("%s case failed: unexpected error %v", c.name, err)
+		case c.expected != "" && (err == nil || !strings.Contains(err.Error(), c.expected)):
+			t.Errorf("%s case failed: expected error '%s' but got '%v' instead", c.name, c.expected, err)
+		}
+	}
+}
+
+func TestNewValidator(t *testing.T) {
+	for _, rule := range []string{"^apps/", "^apps/=", "[=schema.json"} {
+		if _, err := newValidator(nil, []string{rule}); err == nil {
+			t.Errorf("expected error for schema rule '%s'", rule)
+		}
+	}
+}
+
+func TestConfigmapUploader_UploadInvalid(t *testing.T) {
+	existing := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "git2kube", Namespace: "default"},
+		Data:       map[string]string{"test.yaml": "a: 1\n"},
+	}
+	fakeclient := testclient.NewSimpleClientset(existing)
+	v, err := newValidator([]*regexp.Regexp{regexp.MustCompile(".*")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cu := &configmapUploader{
+		clientset:    fakeclient,
+		namespace:    "default",
+		name:         "git2kube",
+		labels:       map[string]string{},
+		annotations:  map[string]string{},
+		includes:     []*regexp.Regexp{regexp.MustCompile(".*")},
+		mergeType:    Delete,
+		transformers: []transformer{v},
+	}
+
+	file, err := newMemoryFile("test.yaml", filemode.Regular, []byte("a: [\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cu.Upload(testCommit, &fileIter{files: []*object.File{file}}); err == nil {
+		t.Fatal("expected invalid file to abort the upload")
+	}
+
+	res, _ := fakeclient.CoreV1().ConfigMaps("default").Get(context.TODO(), "git2kube", metav1.GetOptions{})
+	if res.Data["test.yaml"] != "a: 1\n" {
+		t.Errorf("expected previous version to be kept but got '%s' instead", res.Data["test.yaml"])
+	}
+}